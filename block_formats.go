@@ -1,5 +1,12 @@
 package quill
 
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
 // paragraph
 type textFormat struct{}
 
@@ -16,31 +23,72 @@ func (*textFormat) HasFormat(o *Op) bool {
 }
 
 // block quote
-type blockQuoteFormat struct{}
+type blockQuoteFormat struct {
+	cite string // the URL of the source of the quote (optional)
+}
 
-func (*blockQuoteFormat) Fmt() *Format {
-	return &Format{
+func (bf *blockQuoteFormat) Fmt() *Format {
+	fm := &Format{
 		Val:   "blockquote",
 		Place: Tag,
 		Block: true,
 	}
+	if bf.cite != "" {
+		fm.Attrs = map[string]string{"cite": bf.cite}
+	}
+	return fm
 }
 
 func (*blockQuoteFormat) HasFormat(o *Op) bool {
 	return o.HasAttr("blockquote")
 }
 
+// isBlockID says if id can be written as the id of a block element (see Options.BlockIDs).
+func isBlockID(id string) bool {
+	if id == "" || !(id[0] >= 'a' && id[0] <= 'z' || id[0] >= 'A' && id[0] <= 'Z') {
+		return false
+	}
+	for _, r := range id {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+			return false
+		}
+	}
+	return true
+}
+
 // header
 type headerFormat struct {
-	level string // the string "1", "2", "3", ...
+	level  string // the string "1", "2", "3", ...
+	offset int    // the amount by which to shift the level
+	aria   bool   // whether to write ARIA heading attributes
 }
 
 func (hf *headerFormat) Fmt() *Format {
-	return &Format{
-		Val:   "h" + hf.level,
+	level := hf.shiftedLevel()
+	fm := &Format{
+		Val:   "h" + level,
 		Place: Tag,
 		Block: true,
 	}
+	if hf.aria {
+		fm.Attrs = map[string]string{"role": "heading", "aria-level": level}
+	}
+	return fm
+}
+
+// shiftedLevel gives the level shifted by the offset and kept from 1 to 6. A level that is not a number is not changed.
+func (hf *headerFormat) shiftedLevel() string {
+	n, err := strconv.Atoi(hf.level)
+	if hf.offset == 0 || err != nil {
+		return hf.level
+	}
+	n += hf.offset
+	if n < 1 {
+		n = 1
+	} else if n > 6 {
+		n = 6
+	}
+	return strconv.Itoa(n)
 }
 
 func (hf *headerFormat) HasFormat(o *Op) bool {
@@ -49,38 +97,90 @@ func (hf *headerFormat) HasFormat(o *Op) bool {
 
 // list
 type listFormat struct {
-	lType  string // either "ul" or "ol"
-	indent uint8  // the number of nested
+	lType    string // either "ul" or "ol"
+	indent   int    // the number of nested
+	checked  string // for checklist items, either "true" or "false"
+	checkbox bool   // whether to render checklist items with a checkbox input instead of Quill's markup
+	aria     bool   // whether to write ARIA roles on the list and its items
+
+	attrs map[string]string // additional HTML attributes of the list element
+
+	// With the ContinueLists option, the number of the first item of an ordered list and the count of the top-level
+	// ordered items in the lists already closed.
+	start int
+	items *int
+
+	// For the format that opened an ordered list, the numbers of the last items at each indent level and the number of
+	// the last item of any level.
+	counts []int
+	last   int
+}
+
+// setType sets the kind of list according to the value of the "list" attribute.
+func (lf *listFormat) setType(list string) {
+	switch list {
+	case "bullet":
+		lf.lType = "ul"
+	case "checked":
+		lf.lType, lf.checked = "ul", "true"
+	case "unchecked":
+		lf.lType, lf.checked = "ul", "false"
+	default:
+		lf.lType = "ol"
+	}
 }
 
 func (lf *listFormat) Fmt() *Format {
-	return &Format{
+	fm := &Format{
 		Val:   "li",
 		Place: Tag,
 		Block: true,
 	}
+	if lf.aria {
+		fm.Attrs = map[string]string{"role": "listitem"}
+	}
+	return fm
 }
 
 func (lf *listFormat) HasFormat(o *Op) bool {
-	return o.HasAttr("list")
+	return isListItem(o)
 }
 
-// listFormat implements the FormatWrapper interface.
-func (lf *listFormat) Wrap() (string, string) {
-	return "<" + lf.lType + ">", "</" + lf.lType + ">"
+// isListItem says if the Op has a "list" attribute that makes its line a list item. Lines with the "none" list type,
+// which some configurations use for lines that are only indented, are not list items.
+func isListItem(o *Op) bool {
+	return o.HasAttr("list") && o.Attrs["list"] != "none"
 }
 
 // listFormat implements the FormatWrapper interface.
-func (lf *listFormat) Open(open []*Format, o *Op) bool {
-	// If there is a list of this type already open, no need to open another.
-	for i := range open {
-		if open[i].Place == Tag && open[i].Val == "<"+lf.lType+">" {
-			return false
-		}
+func (lf *listFormat) Wrap() (string, string) {
+	pre := "<" + lf.lType
+	if lf.checked != "" && !lf.checkbox {
+		pre += ` data-checked="` + lf.checked + `"`
+	}
+	if lf.aria {
+		pre += ` role="list"`
+	}
+	if lf.start > 1 {
+		pre += ` start="` + strconv.Itoa(lf.start) + `"`
 	}
+	if len(lf.attrs) > 0 {
+		var buf bytes.Buffer
+		writeAttrs(&buf, lf.attrs)
+		pre += buf.String()
+	}
+	return pre + ">", "</" + lf.lType + ">"
+}
+
+// listFormat implements the FormatWrapper interface. An item is added to a list of the same type that is already open
+// (see Merge), so Open is called only to start a new list.
+func (lf *listFormat) Open([]*Format, *Op) bool {
 	return true
 }
 
+// listFormat implements the MergeableWrapper interface.
+func (*listFormat) Merge(*Op) {}
+
 // listFormat implements the FormatWrapper interface.
 func (lf *listFormat) Close(open []*Format, o *Op, doingBlock bool) bool {
 
@@ -88,9 +188,19 @@ func (lf *listFormat) Close(open []*Format, o *Op, doingBlock bool) bool {
 		return false
 	}
 
-	t := o.Attrs["list"] // The type of the current list item (ordered or bullet).
+	// Close the list if the current item needs a different kind of list.
+	next := listFormat{checkbox: lf.checkbox, aria: lf.aria, attrs: lf.attrs, start: lf.start}
+	next.setType(o.Attrs["list"])
+	pre, _ := lf.Wrap()
+	nextPre, _ := next.Wrap()
 
-	return !o.HasAttr("list") || (t == "ordered" && lf.lType != "ol") || (t == "bullet" && lf.lType != "ul")
+	if !isListItem(o) || pre != nextPre {
+		if lf.items != nil && len(lf.counts) > 0 {
+			*lf.items = lf.counts[0] // A later ordered list continues from here.
+		}
+		return true
+	}
+	return false
 
 	// Currently, the way Quill.js renders nested lists isn't very satisfactory. But we'll stay consistent with how
 	// it appears to users for now. The code below is mostly correct for a better way to render nested lists.
@@ -100,7 +210,7 @@ func (lf *listFormat) Close(open []*Format, o *Op, doingBlock bool) bool {
 	//}
 
 	//t := o.Attrs["list"]                   // The type of the current list item (ordered or bullet).
-	// ind := indentDepths[o.Attrs["indent"]] // The indent of the current list item.
+	// ind := indentDepth(o.Attrs["indent"], max) // The indent of the current list item.
 
 	// Close the list block only if both (a) the current list item is staying at the same indent level or is at a
 	// lower indent level and (b) the type of the list is different from the type of the previous.
@@ -108,13 +218,70 @@ func (lf *listFormat) Close(open []*Format, o *Op, doingBlock bool) bool {
 
 }
 
-// indentDepths gives either the indent amount of a list or 0 if there is no indenting.
-var indentDepths = map[string]uint8{
-	"1": 1,
-	"2": 2,
-	"3": 3,
-	"4": 4,
-	"5": 5,
+// listFormat implements the blockContentFormatter interface.
+func (lf *listFormat) blockContent(*Op) (string, string) {
+	switch {
+	case !lf.checkbox || lf.checked == "":
+		return "", ""
+	case lf.checked == "true":
+		return `<input type="checkbox" checked disabled> `, ""
+	default:
+		return `<input type="checkbox" disabled> `, ""
+	}
+}
+
+// listFormat implements the blockAttrsFormatter interface. Indented items are written in the same list element as the
+// items around them (as Quill does), so an ordered item is given a value attribute wherever the browser would not number
+// it correctly: nested items restart at 1, and the numbering of a level continues after the items nested in it.
+func (lf *listFormat) blockAttrs(open []*Format, _ *Op) map[string]string {
+
+	if lf.lType != "ol" {
+		return nil
+	}
+
+	// Find the format that opened the list that this item is in.
+	var list *listFormat
+	for i := len(open) - 1; i >= 0 && list == nil; i-- {
+		if open[i].wrap {
+			list, _ = open[i].fm.(*listFormat)
+		}
+	}
+	if list == nil {
+		return nil
+	}
+
+	if list.counts == nil && list.start > 1 {
+		// The browser numbers the first item with the start of the list.
+		list.counts = []int{list.start - 1}
+		list.last = list.start - 1
+	}
+
+	for len(list.counts) <= lf.indent {
+		list.counts = append(list.counts, 0)
+	}
+	list.counts = list.counts[:lf.indent+1] // Deeper levels start over.
+	list.counts[lf.indent]++
+
+	n, prev := list.counts[lf.indent], list.last
+	list.last = n
+	if n == prev+1 {
+		return nil // The browser gives this number.
+	}
+	return map[string]string{"value": strconv.Itoa(n)}
+
+}
+
+// indentDepth gives the indent amount given by the "indent" attribute value (or 0 if there is no indenting), limited to max
+// if max is positive. A value that is not a number or that is negative (as given by bad data) counts as no indenting.
+func indentDepth(attr string, max int) int {
+	d, err := strconv.Atoi(attr)
+	if err != nil || d < 0 {
+		return 0
+	}
+	if max > 0 && d > max {
+		return max
+	}
+	return d
 }
 
 // text alignment
@@ -134,13 +301,50 @@ func (af *alignFormat) HasFormat(o *Op) bool {
 	return o.Attrs["align"] == af.val
 }
 
+// classes given by the "class" attribute (only those allowed)
+type classFormat struct {
+	attr    string // the value of the "class" attribute
+	allowed string // the allowed classes in attr separated by spaces
+}
+
+// newClassFormat returns a format for the classes in the "class" attribute value that are in allowed, or nil if there
+// are no such classes.
+func newClassFormat(attr string, allowed []string) *classFormat {
+	var names []string
+	for _, c := range strings.Fields(attr) {
+		for i := range allowed {
+			if c == allowed[i] {
+				names = append(names, c)
+				break
+			}
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	return &classFormat{attr: attr, allowed: strings.Join(names, " ")}
+}
+
+func (cf *classFormat) Fmt() *Format {
+	return &Format{
+		Val:   cf.allowed,
+		Place: Class,
+		Block: true,
+	}
+}
+
+func (cf *classFormat) HasFormat(o *Op) bool {
+	return o.Attrs["class"] == cf.attr
+}
+
 type indentFormat struct {
-	in string
+	in    string // the value of the "indent" attribute
+	depth int    // the indent amount (limited to the maximum depth, if there is one)
 }
 
 func (inf *indentFormat) Fmt() *Format {
 	return &Format{
-		Val:   "indent-" + inf.in,
+		Val:   "indent-" + strconv.Itoa(inf.depth),
 		Place: Class,
 		Block: true,
 	}
@@ -152,7 +356,26 @@ func (inf *indentFormat) HasFormat(o *Op) bool {
 
 // code block
 type codeBlockFormat struct {
-	o *Op
+	o      *Op
+	lang   string // the language of the code (as set by Quill 2), if any
+	cont   bool   // whether this line continues a code block that is already open
+	indent int    // the indent amount of the line, written as leading tabs
+	lines  bool   // whether to write each line in a span for numbering
+}
+
+// codeLanguage gives the language set by the "code-block" attribute value, or "" if the value does not name a language
+// (as with Quill 1, which sets the value true, and with the "plain" value of Quill 2). Languages with characters other
+// than letters, digits, and "-", "_", "+", or "#" are ignored.
+func codeLanguage(attr string) string {
+	if attr == "y" || attr == "plain" {
+		return ""
+	}
+	for _, c := range attr {
+		if !unicode.IsLetter(c) && !unicode.IsDigit(c) && !strings.ContainsRune("-_+#", c) {
+			return ""
+		}
+	}
+	return attr
 }
 
 func (cf *codeBlockFormat) Fmt() *Format {
@@ -166,31 +389,135 @@ func (cf *codeBlockFormat) HasFormat(o *Op) bool {
 	return false // Only a wrapper.
 }
 
-// codeBlockFormat implements the FormatWrapper interface.
-func (*codeBlockFormat) Wrap() (string, string) {
+// codeBlockFormat implements the FormatWrapper interface. Code with a language is written in a <code> element with the
+// class that highlight.js and Prism use to recognize the language.
+func (cf *codeBlockFormat) Wrap() (string, string) {
+	if cf.lang != "" {
+		return `<pre><code class="language-` + cf.lang + `">`, "\n</code></pre>"
+	}
 	return "<pre>", "\n</pre>"
 }
 
 // codeBlockFormat implements the FormatWrapper interface.
-func (*codeBlockFormat) Open(open []*Format, _ *Op) bool {
-	// If there is a code block already open, no need to open another.
-	for i := range open {
-		if open[i].Place == Tag && open[i].Val == "<pre>" {
-			return false
-		}
-	}
+func (*codeBlockFormat) Open([]*Format, *Op) bool {
 	return true
 }
 
+// codeBlockFormat implements the MergeableWrapper interface. A line is added to a code block that is already open.
+func (cf *codeBlockFormat) Merge(*Op) {
+	cf.cont = true
+}
+
 // codeBlockFormat implements the FormatWrapper interface.
 func (cf *codeBlockFormat) Close(_ []*Format, o *Op, doingBlock bool) bool {
-	if doingBlock && !o.HasAttr("code-block") {
-		return true
+	return doingBlock && (!o.HasAttr("code-block") || codeLanguage(o.Attrs["code-block"]) != cf.lang)
+}
+
+// codeBlockFormat implements the blockContentFormatter interface. Lines in a code block cannot have classes of their own,
+// so indented lines are indented with tabs (as the Tab key indents code in Quill).
+func (cf *codeBlockFormat) blockContent(*Op) (string, string) {
+	pre, post := strings.Repeat("\t", cf.indent), ""
+	if cf.lines {
+		pre, post = `<span class="line">`+pre, "</span>"
+	}
+	// Each line after the first is preceded by the line feed ending the previous line.
+	if cf.cont {
+		pre = "\n" + pre
 	}
-	// We are simply adding another line to the code block. The previous line should end with
-	// a "\n" though all instances of "\n" are stripped out by the split from the start.
+	return pre, post
+}
+
+// details (a disclosure widget whose first line is the summary)
+type detailsFormat struct {
+	cont bool // whether this line continues a details element that is already open
+}
+
+func (*detailsFormat) Fmt() *Format {
+	return &Format{
+		Place: Tag,
+		Block: true,
+	}
+}
+
+func (*detailsFormat) HasFormat(*Op) bool {
+	return false // Only a wrapper.
+}
+
+// detailsFormat implements the FormatWrapper interface.
+func (*detailsFormat) Wrap() (string, string) {
+	return "<details>", "</details>"
+}
+
+// detailsFormat implements the FormatWrapper interface.
+func (*detailsFormat) Open([]*Format, *Op) bool {
+	return true
+}
+
+// detailsFormat implements the MergeableWrapper interface. A line after the summary is added to the details element.
+func (df *detailsFormat) Merge(*Op) {
+	df.cont = true
+}
+
+// detailsFormat implements the FormatWrapper interface.
+func (*detailsFormat) Close(_ []*Format, o *Op, doingBlock bool) bool {
+	return doingBlock && !o.HasAttr("details")
+}
+
+// detailsFormat implements the blockContentFormatter interface.
+func (df *detailsFormat) blockContent(*Op) (string, string) {
+	if df.cont {
+		return "<p>", "</p>"
+	}
+	return "<summary>", "</summary>"
+}
+
+// table cell (Quill's table module sets the ID of the row as the "table" attribute of each cell's line)
+type tableFormat struct {
+	row       string // the ID of the row of the cell
+	pre, post string // set by Open depending on whether a table is already open
+}
+
+func (tf *tableFormat) Fmt() *Format {
+	return &Format{
+		Val:   "td",
+		Place: Tag,
+		Block: true,
+	}
+}
+
+func (tf *tableFormat) HasFormat(o *Op) bool {
+	return o.Attrs["table"] == tf.row
+}
+
+// tableFormat implements the FormatWrapper interface.
+func (tf *tableFormat) Wrap() (string, string) {
+	return tf.pre, tf.post
+}
+
+// tableFormat implements the FormatWrapper interface.
+func (tf *tableFormat) Open(open []*Format, _ *Op) bool {
+	// The latest table format open holds the row that the previous cell is in.
+	for i := len(open) - 1; i >= 0; i-- {
+		if t, ok := open[i].fm.(*tableFormat); ok {
+			if t.row == tf.row {
+				return false // Simply adding a cell to the current row.
+			}
+			// Start a new row within the open table; the table itself is closed by the format that opened it.
+			tf.pre, tf.post = "</tr><tr>", ""
+			return true
+		}
+	}
+	tf.pre, tf.post = "<table><tr>", "</tr></table>"
+	return true
+}
+
+// tableFormat implements the FormatWrapper interface.
+func (tf *tableFormat) Close(_ []*Format, o *Op, doingBlock bool) bool {
 	if !doingBlock {
-		o.Data = "\n" + o.Data
+		return false
 	}
-	return false
+	if tf.post == "" { // This format only started a new row.
+		return !tf.HasFormat(o)
+	}
+	return !o.HasAttr("table")
 }
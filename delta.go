@@ -0,0 +1,406 @@
+package quill
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// parseDelta unmarshals a Delta array of insert operations. The array may also be given as the "ops" field of an object
+// (as Quill's Delta objects are stored by some applications), such as {"ops":[{"insert":"text\n"}]}.
+func parseDelta(ops []byte) ([]rawOp, error) {
+	if trimmed := bytes.TrimLeft(ops, " \t\r\n"); len(trimmed) > 0 && trimmed[0] == '{' {
+		var delta struct {
+			Ops *[]rawOp `json:"ops"`
+		}
+		if err := json.Unmarshal(trimmed, &delta); err != nil {
+			return nil, err
+		}
+		if delta.Ops == nil {
+			return nil, errNoOps
+		}
+		return *delta.Ops, nil
+	}
+	raw := make([]rawOp, 0, 12)
+	if err := json.Unmarshal(ops, &raw); err != nil {
+		return nil, err
+	}
+	return raw, nil
+}
+
+// IsEmpty says if a Delta array of insert operations has no meaningful content: all of its text inserts consist only of
+// whitespace (such as the line feed that ends every Quill document), and it has no embeds.
+func IsEmpty(ops []byte) (bool, error) {
+
+	raw, err := parseDelta(ops)
+	if err != nil {
+		return false, err
+	}
+
+	o := Op{Attrs: make(map[string]string, 3)}
+	for i := range raw {
+		if err = raw[i].makeOp(&o); err != nil {
+			return false, err
+		}
+		if o.Type != "text" || strings.IndexFunc(o.Data, isNotSpace) != -1 {
+			return false, nil
+		}
+	}
+
+	return true, nil
+
+}
+
+func isNotSpace(r rune) bool {
+	return !unicode.IsSpace(r)
+}
+
+// Validate checks that a Delta array of insert operations can be rendered with the built-in settings (including the
+// registered formats and the formats set with SetDefaultFormats): it must be valid JSON, and there must be a format for
+// the type of every op. No HTML is rendered, so Validate is cheaper than Render when only the validity is needed.
+func Validate(ops []byte) error {
+
+	raw, err := parseDelta(ops)
+	if err != nil {
+		return err
+	}
+
+	opts := &Options{CustomFormats: getDefaultFormats()}
+	o := Op{Attrs: make(map[string]string, 3)}
+	for i := range raw {
+		if err = raw[i].makeOp(&o); err != nil {
+			return opError(raw, i, err)
+		}
+		if o.getFormatter(o.Type, opts) == nil {
+			return opError(raw, i, errNoTypeFormat(raw[i]))
+		}
+	}
+
+	return nil
+
+}
+
+// Truncate renders a Delta array of insert operations with its visible text limited to maxRunes characters. Characters
+// are counted as Unicode code points, so a multi-byte character (such as an emoji) is never split. Line feeds are not
+// counted, and each embed counts as one character. The line in which the text is cut keeps its block format.
+func Truncate(ops []byte, maxRunes int) ([]byte, error) {
+
+	raw, err := parseDelta(ops)
+	if err != nil {
+		return nil, err
+	}
+
+	raw, _ = truncateOps(raw, maxRunes, "")
+
+	var buf bytes.Buffer
+	err = renderOps(&buf, raw, Options{})
+	return buf.Bytes(), err
+
+}
+
+// Ellipsis is the text that RenderPreview appends where it cuts off a Delta.
+const Ellipsis = "\u2026"
+
+// RenderPreview renders a Delta array of insert operations like Truncate does but appends an Ellipsis where the text is
+// cut off. The Ellipsis is written after any inline formats of the cut text are closed, inside the block in which the cut
+// falls, so the output is always well-formed HTML. Nothing is appended if the whole text fits within maxRunes characters.
+func RenderPreview(ops []byte, maxRunes int) ([]byte, error) {
+
+	raw, err := parseDelta(ops)
+	if err != nil {
+		return nil, err
+	}
+
+	raw, _ = truncateOps(raw, maxRunes, Ellipsis)
+
+	var buf bytes.Buffer
+	err = renderOps(&buf, raw, Options{})
+	return buf.Bytes(), err
+
+}
+
+// truncateOps limits the visible text of the ops to maxRunes characters in the way that Truncate describes. If anything is
+// cut off, the ellipsis (if not empty) is added as plain text at the end of the last line kept. The returned bool says if
+// anything was cut off.
+func truncateOps(raw []rawOp, maxRunes int, ellipsis string) ([]rawOp, bool) {
+	n := 0
+	for i := range raw {
+		s, ok := raw[i].Insert.(string)
+		if !ok { // an embed
+			if n == maxRunes {
+				return cutOps(raw, i, "", "", ellipsis), true
+			}
+			n++
+			continue
+		}
+		for j, r := range s {
+			if r == '\n' {
+				continue
+			}
+			if n == maxRunes {
+				return cutOps(raw, i, s[:j], s[j:], ellipsis), true
+			}
+			n++
+		}
+	}
+	return raw, false
+}
+
+// lastInsert gives the text of the last op, if there is an op. An embed gives an empty string.
+func lastInsert(raw []rawOp) (string, bool) {
+	if len(raw) == 0 {
+		return "", false
+	}
+	s, _ := raw[len(raw)-1].Insert.(string)
+	return s, true
+}
+
+// cutOps returns the ops before index i followed by an op with the text kept from op i (if any), and then a line feed
+// op with the attributes of the op that has the line feed that would have ended the line that is cut (if there is one and
+// the line has any content).
+// The text of op i that is cut off is given by rest. A non-empty ellipsis is added as an op without attributes at the end
+// of the line that is cut or, if the cut is at the start of a line, at the end of the line before it.
+func cutOps(raw []rawOp, i int, kept, rest, ellipsis string) []rawOp {
+
+	cut := make([]rawOp, i, i+4)
+	copy(cut, raw[:i])
+
+	if kept != "" {
+		cut = append(cut, rawOp{Insert: kept, Attrs: raw[i].Attrs})
+	} else if prev, ok := lastInsert(cut); !ok || (prev != "" && prev[len(prev)-1] == '\n') {
+		// The cut is at the start of a line, so there is no line to end.
+		if ellipsis == "" {
+			return cut
+		}
+		if !ok {
+			return append(cut, rawOp{Insert: ellipsis})
+		}
+		last := cut[len(cut)-1]
+		cut = cut[:len(cut)-1]
+		if len(prev) > 1 {
+			cut = append(cut, rawOp{Insert: prev[:len(prev)-1], Attrs: last.Attrs})
+		}
+		return append(cut, rawOp{Insert: ellipsis}, rawOp{Insert: "\n", Attrs: last.Attrs})
+	}
+
+	if ellipsis != "" {
+		cut = append(cut, rawOp{Insert: ellipsis})
+	}
+
+	for k := i; k < len(raw); k++ {
+		s, _ := raw[k].Insert.(string)
+		if k == i {
+			s = rest
+		}
+		if strings.IndexByte(s, '\n') != -1 {
+			cut = append(cut, rawOp{Insert: "\n", Attrs: raw[k].Attrs})
+			break
+		}
+	}
+
+	return cut
+
+}
+
+// A deltaLine is the plain text of a line of a Delta with the attributes of the line feed that ends it.
+type deltaLine struct {
+	text  string
+	attrs map[string]string
+}
+
+// plainLines returns the plain text of each line of the parsed Delta insert operations. Embeds are left out. Text that is
+// not followed by a line feed forms a last line without attributes.
+func plainLines(raw []rawOp) ([]deltaLine, error) {
+
+	var lines []deltaLine
+	var text strings.Builder
+
+	o := Op{Attrs: make(map[string]string, 3)}
+	for i := range raw {
+		if err := raw[i].makeOp(&o); err != nil {
+			return nil, err
+		}
+		if o.Type != "text" {
+			continue
+		}
+		parts := strings.Split(o.Data, "\n")
+		for j, part := range parts {
+			text.WriteString(part)
+			if j == len(parts)-1 {
+				break
+			}
+			attrs := make(map[string]string, len(o.Attrs))
+			for k, v := range o.Attrs {
+				attrs[k] = v
+			}
+			lines = append(lines, deltaLine{text: text.String(), attrs: attrs})
+			text.Reset()
+		}
+	}
+
+	if text.Len() > 0 {
+		lines = append(lines, deltaLine{text: text.String()})
+	}
+
+	return lines, nil
+
+}
+
+// previewExcerptRunes is the maximum number of characters in the excerpt given by Preview (not counting the Ellipsis).
+const previewExcerptRunes = 200
+
+// Preview extracts the information for a link preview from a Delta array of insert operations: the text of the first
+// header as the title, the URL of the first image, and an excerpt of the plain text of the other lines. The whitespace in
+// the excerpt is collapsed, and an excerpt that is cut short ends with an Ellipsis.
+func Preview(ops []byte) (title string, image string, excerpt string, err error) {
+
+	raw, err := parseDelta(ops)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	o := Op{Attrs: make(map[string]string, 3)}
+	for i := range raw {
+		if err = raw[i].makeOp(&o); err != nil {
+			return "", "", "", err
+		}
+		if o.Type == "image" {
+			image = o.Data
+			break
+		}
+	}
+
+	lines, err := plainLines(raw)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	var words []string
+	titled := false
+	for _, line := range lines {
+		if !titled && line.attrs["header"] != "" {
+			title = strings.Join(strings.Fields(line.text), " ")
+			titled = true
+			continue
+		}
+		words = append(words, strings.Fields(line.text)...)
+	}
+
+	return title, image, excerptOf(strings.Join(words, " "), previewExcerptRunes), nil
+
+}
+
+// Excerpt gives the plain text of the first line of a Delta array of insert operations that has any text (such as the
+// first paragraph), for pages that list documents. The whitespace in the text is collapsed, and if maxChars is positive,
+// the text is cut to at most maxChars characters (not counting the Ellipsis that ends an excerpt that is cut short).
+func Excerpt(ops []byte, maxChars int) (string, error) {
+
+	raw, err := parseDelta(ops)
+	if err != nil {
+		return "", err
+	}
+
+	lines, err := plainLines(raw)
+	if err != nil {
+		return "", err
+	}
+
+	for _, line := range lines {
+		if text := strings.Join(strings.Fields(line.text), " "); text != "" {
+			if maxChars > 0 {
+				text = excerptOf(text, maxChars)
+			}
+			return text, nil
+		}
+	}
+
+	return "", nil
+
+}
+
+// excerptOf cuts s to at most maxRunes characters at the end of a word (if there is one within the limit) and appends an
+// Ellipsis if anything is cut off.
+func excerptOf(s string, maxRunes int) string {
+	n := 0
+	for i := range s {
+		if n == maxRunes {
+			cut := s[:i]
+			if sp := strings.LastIndexByte(cut, ' '); sp > 0 {
+				cut = cut[:sp]
+			}
+			return cut + Ellipsis
+		}
+		n++
+	}
+	return s
+}
+
+// A TOCEntry is a header of a Delta as listed by TableOfContents.
+type TOCEntry struct {
+	Level int    // the level of the header, from 1 to 6
+	Text  string // the plain text of the header with its whitespace collapsed
+	Slug  string // an identifier made from the text that is unique within the Delta, for linking to the header
+}
+
+// TableOfContents lists the headers of a Delta array of insert operations in order, for building a table of contents.
+// Lines with a header attribute that is not a level from 1 to 6 are left out.
+func TableOfContents(ops []byte) ([]TOCEntry, error) {
+
+	raw, err := parseDelta(ops)
+	if err != nil {
+		return nil, err
+	}
+
+	lines, err := plainLines(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	var toc []TOCEntry
+	used := make(map[string]bool)
+	for _, line := range lines {
+		level, err := strconv.Atoi(line.attrs["header"])
+		if err != nil || level < 1 || level > 6 {
+			continue
+		}
+		text := strings.Join(strings.Fields(line.text), " ")
+		toc = append(toc, TOCEntry{Level: level, Text: text, Slug: uniqueSlug(slugify(text), used)})
+	}
+
+	return toc, nil
+
+}
+
+// slugify makes an identifier of lowercase letters, digits, and hyphens from text: each run of other characters becomes a
+// single hyphen, and hyphens at the ends are dropped. Text without any letters or digits gives "section".
+func slugify(text string) string {
+	var b strings.Builder
+	hyphen := false
+	for _, r := range strings.ToLower(text) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if hyphen && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			hyphen = false
+		} else {
+			hyphen = true
+		}
+	}
+	if b.Len() == 0 {
+		return "section"
+	}
+	return b.String()
+}
+
+// uniqueSlug returns slug, or slug with the lowest number suffix (such as "-2") that is not in used, and adds it to used.
+func uniqueSlug(slug string, used map[string]bool) string {
+	unique := slug
+	for n := 2; used[unique]; n++ {
+		unique = slug + "-" + strconv.Itoa(n)
+	}
+	used[unique] = true
+	return unique
+}
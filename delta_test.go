@@ -0,0 +1,221 @@
+package quill
+
+import (
+	"testing"
+	"unicode/utf8"
+)
+
+func TestIsEmpty(t *testing.T) {
+
+	cases := map[string]bool{
+		`[]`:                true,
+		`[{"insert":"\n"}]`: true,
+		`[{"insert":" \t\n"},{"attributes":{"header":1},"insert":"\n"}]`: true,
+		`[{"insert":"text\n"}]`:                               false,
+		`[{"insert":{"image":"source-url"}},{"insert":"\n"}]`: false,
+	}
+
+	for ops, want := range cases {
+		got, err := IsEmpty([]byte(ops))
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+		if got != want {
+			t.Errorf("expected %v for %s", want, ops)
+		}
+	}
+
+	if _, err := IsEmpty([]byte(`[{"attributes":{"bold":true}}]`)); err == nil {
+		t.Errorf("expected an error for an op without an insert")
+	}
+
+}
+
+func TestTruncate(t *testing.T) {
+
+	ops := []byte(`[{"insert":"Hi 😀😀 there"},{"attributes":{"header":1},"insert":"\n"},{"insert":"more text\n"}]`)
+
+	cases := []struct {
+		max  int
+		want string
+	}{
+		{0, ""},
+		{4, "<h1>Hi 😀</h1>"},
+		{5, "<h1>Hi 😀😀</h1>"},
+		{11, "<h1>Hi 😀😀 there</h1>"},
+		{12, "<h1>Hi 😀😀 there</h1><p>m</p>"},
+		{100, "<h1>Hi 😀😀 there</h1><p>more text</p>"},
+	}
+
+	for _, tc := range cases {
+		got, err := Truncate(ops, tc.max)
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+		if string(got) != tc.want {
+			t.Errorf("(max %d) expected %q but got %q", tc.max, tc.want, got)
+		}
+		if !utf8.Valid(got) {
+			t.Errorf("(max %d) split a character", tc.max)
+		}
+	}
+
+}
+
+func TestRenderPreview(t *testing.T) {
+
+	ops := []byte(`[{"insert":"Hi "},{"attributes":{"bold":true,"italic":true},"insert":"bold words"},{"insert":" end"},` +
+		`{"attributes":{"header":2},"insert":"\n"},{"insert":"more text\n"}]`)
+
+	cases := []struct {
+		max  int
+		want string
+	}{
+		{0, "<p>…</p>"},
+		{6, "<h2>Hi <em><strong>bol</strong></em>…</h2>"},
+		{17, "<h2>Hi <em><strong>bold words</strong></em> end…</h2>"},
+		{18, "<h2>Hi <em><strong>bold words</strong></em> end</h2><p>m…</p>"},
+		{100, "<h2>Hi <em><strong>bold words</strong></em> end</h2><p>more text</p>"},
+	}
+
+	for _, tc := range cases {
+		got, err := RenderPreview(ops, tc.max)
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+		if string(got) != tc.want {
+			t.Errorf("(max %d) expected %q but got %q", tc.max, tc.want, got)
+		}
+	}
+
+}
+
+func TestValidate(t *testing.T) {
+
+	if err := Validate([]byte(`[{"insert":"a"},{"insert":{"image":"/a.png"}},{"attributes":{"header":1},"insert":"\n"}]`)); err != nil {
+		t.Errorf("valid delta: %s", err)
+	}
+
+	if err := Validate([]byte(`[{"insert":"a"},{"insert":{"widget":"x"}},{"insert":"\n"}]`)); err == nil {
+		t.Errorf("no error for an unknown type")
+	}
+
+	if err := Validate([]byte(`[{"insert":"a"}`)); err == nil {
+		t.Errorf("no error for malformed JSON")
+	}
+
+}
+
+func TestPreview(t *testing.T) {
+
+	ops := []byte(`[{"insert":"My "},{"attributes":{"bold":true},"insert":"Trip"},{"attributes":{"header":1},"insert":"\n"},` +
+		`{"insert":"We went\tto the "},{"insert":{"image":"/beach.jpg"}},{"insert":" beach.\n\nIt was "},` +
+		`{"insert":{"image":"/sun.jpg"}},{"insert":"sunny.\n"},{"insert":"Other"},{"attributes":{"header":2},"insert":"\n"}]`)
+
+	title, image, excerpt, err := Preview(ops)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if title != "My Trip" {
+		t.Errorf("got title %q", title)
+	}
+	if image != "/beach.jpg" {
+		t.Errorf("got image %q", image)
+	}
+	if want := "We went to the beach. It was sunny. Other"; excerpt != want {
+		t.Errorf("expected excerpt %q but got %q", want, excerpt)
+	}
+
+	if got, want := excerptOf("one two three", 9), "one two"+Ellipsis; got != want {
+		t.Errorf("expected cut excerpt %q but got %q", want, got)
+	}
+
+}
+
+func TestExcerpt(t *testing.T) {
+
+	ops := []byte(`[{"insert":"\n"},{"insert":{"image":"/a.png"}},{"insert":"\nThe  "},{"attributes":{"italic":true},"insert":"first"},` +
+		`{"insert":" paragraph.\nThe second paragraph.\n"}]`)
+
+	cases := []struct {
+		max  int
+		want string
+	}{
+		{0, "The first paragraph."},
+		{100, "The first paragraph."},
+		{12, "The first" + Ellipsis},
+	}
+	for _, tc := range cases {
+		got, err := Excerpt(ops, tc.max)
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+		if got != tc.want {
+			t.Errorf("(max %d) expected %q but got %q", tc.max, tc.want, got)
+		}
+	}
+
+	if got, err := Excerpt([]byte(`[{"insert":"\n"}]`), 10); err != nil || got != "" {
+		t.Errorf("got %q (error %v) for an empty document", got, err)
+	}
+
+}
+
+func TestTableOfContents(t *testing.T) {
+
+	ops := []byte(`[{"insert":"Getting Started"},{"attributes":{"header":1},"insert":"\n"},{"insert":"Intro text.\nWhy  "},` +
+		`{"attributes":{"bold":true},"insert":"Go?"},{"attributes":{"header":2},"insert":"\n"},{"insert":"Install & Setup"},` +
+		`{"attributes":{"header":3},"insert":"\n"},{"insert":"Why Go?"},{"attributes":{"header":2},"insert":"\n"},` +
+		`{"insert":"!!!"},{"attributes":{"header":3},"insert":"\n"},{"insert":"Too deep"},{"attributes":{"header":7},"insert":"\n"}]`)
+
+	got, err := TableOfContents(ops)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	want := []TOCEntry{
+		{1, "Getting Started", "getting-started"},
+		{2, "Why Go?", "why-go"},
+		{3, "Install & Setup", "install-setup"},
+		{2, "Why Go?", "why-go-2"},
+		{3, "!!!", "section"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("expected %d entries but got %d: %+v", len(want), len(got), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("(entry %d) expected %+v but got %+v", i, want[i], got[i])
+		}
+	}
+
+	if _, err = TableOfContents([]byte(`{`)); err == nil {
+		t.Errorf("no error for invalid JSON")
+	}
+
+}
+
+func TestParseDelta(t *testing.T) {
+
+	want := `<p>one <strong>two</strong></p>`
+	for _, ops := range []string{
+		`[{"insert":"one "},{"attributes":{"bold":true},"insert":"two"},{"insert":"\n"}]`,
+		`{"ops":[{"insert":"one "},{"attributes":{"bold":true},"insert":"two"},{"insert":"\n"}]}`,
+		` {"attributes":{"x":1},"ops":[{"insert":"one "},{"attributes":{"bold":true},"insert":"two"},{"insert":"\n"}]}`,
+	} {
+		got, err := Render([]byte(ops))
+		if err != nil {
+			t.Fatalf("%s: %s", ops, err)
+		}
+		if string(got) != want {
+			t.Errorf("%s: expected %q but got %q", ops, want, got)
+		}
+	}
+
+	for _, ops := range []string{`{}`, `{"ops":null}`, `{"ops":{}}`, `{"ops":[]`} {
+		if _, err := Render([]byte(ops)); err == nil {
+			t.Errorf("%s: no error", ops)
+		}
+	}
+
+}
@@ -0,0 +1,51 @@
+package quill
+
+import (
+	"errors"
+	"fmt"
+	"unicode/utf8"
+)
+
+// errNoOps is returned for a Delta given as an object that does not have an array of ops.
+var errNoOps = errors.New(`quill: the Delta object has no "ops" array`)
+
+// A RenderError is returned when an op of a Delta cannot be rendered.
+type RenderError struct {
+	Op     int   // the index of the op in the Delta
+	Offset int   // the approximate position in the document at which the op begins (see opOffset)
+	Err    error // the problem with the op
+}
+
+func (e *RenderError) Error() string {
+	return fmt.Sprintf("%v (op %d at offset %d)", e.Err, e.Op, e.Offset)
+}
+
+// Unwrap returns the problem with the op.
+func (e *RenderError) Unwrap() error {
+	return e.Err
+}
+
+// errNoTypeFormat gives the error for an op with a type for which there is no format.
+func errNoTypeFormat(ro rawOp) error {
+	return fmt.Errorf("quill: an op does not have a format defined for its type: %v", ro)
+}
+
+// opError returns a RenderError for the op at index i of raw.
+func opError(raw []rawOp, i int, err error) *RenderError {
+	return &RenderError{Op: i, Offset: opOffset(raw, i), Err: err}
+}
+
+// opOffset gives the position in the document at which the op at index i begins, counted in characters (runes) of the
+// text before it, with each embed counted as 1.
+func opOffset(raw []rawOp, i int) int {
+	n := 0
+	for _, ro := range raw[:i] {
+		s, ok := ro.Insert.(string)
+		if !ok {
+			n++
+			continue
+		}
+		n += utf8.RuneCountInString(s)
+	}
+	return n
+}
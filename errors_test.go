@@ -0,0 +1,26 @@
+package quill
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestRenderError(t *testing.T) {
+
+	// The offset counts "Hé😀\n" as 4 (one for each rune, including the emoji) and the image as 1.
+	ops := []byte(`[{"insert":"Hé😀\n"},{"insert":{"image":"/a.png"}},{"insert":{"widget":"x"}},{"insert":"\n"}]`)
+
+	_, err := Render(ops)
+	var re *RenderError
+	if !errors.As(err, &re) {
+		t.Fatalf("expected a RenderError but got %v", err)
+	}
+	if re.Op != 2 || re.Offset != 5 {
+		t.Errorf("expected op 2 at offset 5 but got op %d at offset %d", re.Op, re.Offset)
+	}
+
+	if err = Validate(ops); !errors.As(err, &re) || re.Offset != 5 {
+		t.Errorf("Validate gave %v", err)
+	}
+
+}
@@ -0,0 +1,78 @@
+package quill
+
+import (
+	"bytes"
+	"html"
+	"strconv"
+)
+
+// DefaultFootnoteAttr is the attribute that marks footnote references if FootnoteCollector.Attr is not set.
+const DefaultFootnoteAttr = "footnote"
+
+// A FootnoteCollector renders footnotes. Text (or an embed, such as a mention) with the footnote attribute set is followed
+// by a numbered reference, a superscript link to the footnote, and the value of the attribute (the body of the footnote)
+// is collected while the Delta is rendered. After the document, the footnotes are written in an <ol class="footnotes">
+// list. The reference to the Nth footnote is <sup class="footnote-ref"><a href="#fn-N" id="fnref-N">N</a></sup>, and the
+// footnote is written as <li id="fn-N"> with a link back to "#fnref-N". A FootnoteCollector is given to the renderer
+// with the Footnotes option; it should not be used by more than one render at a time.
+type FootnoteCollector struct {
+	Attr string // the attribute name that marks references; if blank, DefaultFootnoteAttr is used
+
+	notes []string // the bodies of the footnotes referenced so far
+}
+
+// attr gives the attribute name that marks references.
+func (fc *FootnoteCollector) attr() string {
+	if fc.Attr != "" {
+		return fc.Attr
+	}
+	return DefaultFootnoteAttr
+}
+
+// writeList writes the footnotes collected and resets the collector for the next document.
+func (fc *FootnoteCollector) writeList(buf *bytes.Buffer) {
+	if len(fc.notes) == 0 {
+		return
+	}
+	buf.WriteString(`<ol class="footnotes">`)
+	for i, note := range fc.notes {
+		n := strconv.Itoa(i + 1)
+		buf.WriteString(`<li id="fn-` + n + `">` + html.EscapeString(note) + ` <a href="#fnref-` + n + `">&#8617;</a></li>`)
+	}
+	buf.WriteString("</ol>")
+	fc.notes = fc.notes[:0]
+}
+
+// footnoteFormat is the Formatter for text with a footnote reference.
+type footnoteFormat struct {
+	fc   *FootnoteCollector
+	body string
+	n    string // the number of the footnote, set when the reference is opened
+}
+
+func (*footnoteFormat) Fmt() *Format { return new(Format) } // Only a wrapper.
+
+func (*footnoteFormat) HasFormat(*Op) bool {
+	return false // Only a wrapper.
+}
+
+// Wrap writes the reference to the footnote added by Open after the text.
+func (ff *footnoteFormat) Wrap() (string, string) {
+	return "", `<sup class="footnote-ref"><a href="#fn-` + ff.n + `" id="fnref-` + ff.n + `">` + ff.n + `</a></sup>`
+}
+
+// Open adds the footnote to the collector if a reference to it is not already open.
+func (ff *footnoteFormat) Open(open []*Format, _ *Op) bool {
+	for i := range open {
+		if f, ok := baseFormatter(open[i].fm).(*footnoteFormat); ok && f.body == ff.body {
+			return false
+		}
+	}
+	ff.fc.notes = append(ff.fc.notes, ff.body)
+	ff.n = strconv.Itoa(len(ff.fc.notes))
+	return true
+}
+
+func (ff *footnoteFormat) Close(_ []*Format, o *Op, _ bool) bool {
+	return o.Attrs[ff.fc.attr()] != ff.body
+}
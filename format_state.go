@@ -3,7 +3,7 @@ package quill
 import (
 	"bytes"
 	"sort"
-	"strconv"
+	"strings"
 )
 
 // A formatState holds the current state of open tag, class, or style formats.
@@ -12,44 +12,88 @@ type formatState []*Format // the list of currently open attribute tags
 // hasSet says if the given format is already opened.
 func (fs *formatState) hasSet(fm *Format) bool {
 	for i := range *fs {
-		if (*fs)[i].Place == fm.Place && (*fs)[i].Val == fm.Val {
+		if (*fs)[i].Place == fm.Place && (*fs)[i].Val == fm.Val && sameAttrs((*fs)[i].Attrs, fm.Attrs) {
 			return true
 		}
 	}
 	return false
 }
 
+// sameAttrs says if a and b have the same attributes.
+func sameAttrs(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if bv, ok := b[k]; !ok || bv != v {
+			return false
+		}
+	}
+	return true
+}
+
 // closePrevious checks if the previous ops opened any formats that are not set on the current Op and closes those formats
 // in the opposite order in which they were opened.
 func (fs *formatState) closePrevious(buf *bytes.Buffer, o *Op, doingBlock bool) {
+	fs.closeFormats(buf, buf, o, doingBlock)
+}
 
-	closedTemp := make(formatState, 0, 1)
+// closeFormats closes the formats that are not set on the current Op (and all inline formats if a block is ending),
+// writing the closing tags of block-level FormatWrapper formats to blockBuf and all others to inlineBuf. Only the minimal
+// set of formats is closed: the formats opened before the first format that must be closed (the longest common prefix of
+// the open formats and those of o) stay open, and any formats after it that are still set on o are reopened in the same
+// order in which they were opened.
+func (fs *formatState) closeFormats(inlineBuf, blockBuf *bytes.Buffer, o *Op, doingBlock bool) {
 
+	// Find the formats that need to be closed, asking each format only once.
+	first := len(*fs)
+	keep := make([]bool, len(*fs))
 	for i := len(*fs) - 1; i >= 0; i-- { // Start with the last format opened.
-
 		f := (*fs)[i]
+		// Inline formats never continue past the end of a block.
+		if (doingBlock && !f.Block) || (!f.wrap && !f.fm.HasFormat(o)) || (f.wrap && f.fm.(FormatWrapper).Close(*fs, o, doingBlock)) {
+			first = i
+		} else {
+			keep[i] = true
+		}
+	}
 
-		// If this format is not set on the current Op, close it.
-		if (!f.wrap && !f.fm.HasFormat(o)) || (f.wrap && f.fm.(FormatWrapper).Close(*fs, o, doingBlock)) {
-
-			// If we need to close a tag after which there are tags that should stay open, close the following tags for now.
-			if i < len(*fs)-1 {
-				for ij := len(*fs) - 1; ij > i; ij-- {
-					closedTemp.add((*fs)[ij])
-					fs.pop(buf)
-				}
-			}
-
-			fs.pop(buf)
+	if first == len(*fs) {
+		return // Nothing to close.
+	}
 
+	// Close everything after the common prefix, saving the formats to reopen.
+	reopen := make(formatState, 0, len(*fs)-first)
+	for i := len(*fs) - 1; i >= first; i-- {
+		f := (*fs)[i]
+		if keep[i] {
+			reopen = append(reopen, f)
+		}
+		if f.wrap && f.Block {
+			fs.pop(blockBuf)
+		} else {
+			fs.pop(inlineBuf)
 		}
+	}
 
+	// Re-open the temporarily closed formats in their original order.
+	for i := len(reopen) - 1; i >= 0; i-- {
+		f := reopen[i]
+		if f.wrap && f.Block {
+			f.writeOpen(blockBuf)
+		} else {
+			f.writeOpen(inlineBuf)
+		}
+		*fs = append(*fs, f)
 	}
 
-	// Re-open the temporarily closed formats.
-	closedTemp.writeFormats(buf)
-	*fs = append(*fs, closedTemp...) // Copy after the sorting.
+}
 
+// closeInline closes all of the inline formats, which are opened after any block-level formats that are open.
+func (fs *formatState) closeInline(buf *bytes.Buffer) {
+	for len(*fs) > 0 && !(*fs)[len(*fs)-1].Block {
+		fs.pop(buf)
+	}
 }
 
 // pop removes the last format from the state of currently open formats.
@@ -81,29 +125,35 @@ func (fs *formatState) writeFormats(buf *bytes.Buffer) {
 	sort.Sort(fs) // Ensure that the serialization is consistent even if attribute ordering in a map changes.
 
 	for _, f := range *fs {
+		f.writeOpen(buf)
+	}
 
-		if f.wrap {
-			buf.WriteString(f.Val) // The complete opening or closing wrap is given.
-			continue
-		}
+}
 
-		buf.WriteByte('<')
-
-		switch f.Place {
-		case Tag:
-			buf.WriteString(f.Val)
-		case Class:
-			buf.WriteString("span class=")
-			buf.WriteString(strconv.Quote(f.Val))
-		case Style:
-			buf.WriteString("span style=")
-			buf.WriteString(strconv.Quote(f.Val))
-		}
+// writeOpen writes the opening tag of the format (or its complete opening wrap) to buf.
+func (f *Format) writeOpen(buf *bytes.Buffer) {
 
-		buf.WriteByte('>')
+	if f.wrap {
+		buf.WriteString(f.Val) // The complete opening or closing wrap is given.
+		return
+	}
 
+	buf.WriteByte('<')
+
+	switch f.Place {
+	case Tag:
+		buf.WriteString(f.Val)
+		writeAttrs(buf, f.Attrs)
+	case Class:
+		buf.WriteString("span class=")
+		buf.WriteString(quoteAttr(f.Val))
+	case Style:
+		buf.WriteString("span style=")
+		buf.WriteString(quoteAttr(f.Val))
 	}
 
+	buf.WriteByte('>')
+
 }
 
 // Implement the sort.Interface interface.
@@ -114,23 +164,81 @@ func (fs *formatState) Less(i, j int) bool {
 
 	fsi, fsj := (*fs)[i], (*fs)[j]
 
-	// Formats that implement the FormatWrapper interface are written first.
-	if _, ok := fsi.fm.(FormatWrapper); ok {
-		return true
-	} else if _, ok := fsj.fm.(FormatWrapper); ok {
-		return false
+	// Formats are nested in the order of their priority.
+	if pi, pj := inlinePriority(fsi), inlinePriority(fsj); pi != pj {
+		return pi < pj
 	}
 
-	// Tags are written first, then classes, and then style attributes.
+	// Classes are written before style attributes.
 	if fsi.Place != fsj.Place {
 		return fsi.Place < fsj.Place
 	}
 
-	// Simply check values.
-	return fsi.Val < fsj.Val
+	// Style attributes are written in the canonical order of their properties.
+	if fsi.Place == Style {
+		return styleLess(fsi.Val, fsj.Val)
+	}
+
+	// Simply check values (and then attributes).
+	if fsi.Val != fsj.Val {
+		return fsi.Val < fsj.Val
+	}
+	return attrsLess(fsi.Attrs, fsj.Attrs)
 
 }
 
 func (fs *formatState) Swap(i, j int) {
 	(*fs)[i], (*fs)[j] = (*fs)[j], (*fs)[i]
 }
+
+// attrsLess orders sets of HTML attributes by their attributes in sorted order.
+func attrsLess(a, b map[string]string) bool {
+	var ab, bb bytes.Buffer
+	writeAttrs(&ab, a)
+	writeAttrs(&bb, b)
+	return ab.String() < bb.String()
+}
+
+// inlinePriority gives the order in which an inline format is opened relative to other formats: formats that implement
+// the FormatWrapper interface (such as links) are outermost, then classes and style attributes (such as colors), then
+// tags (such as bold and italic), and inline code is innermost.
+func inlinePriority(f *Format) int {
+	if _, ok := f.fm.(FormatWrapper); ok {
+		return 0
+	}
+	if _, ok := baseFormatter(f.fm).(*codeFormat); ok {
+		return 3
+	}
+	if f.Place == Tag {
+		return 2
+	}
+	return 1
+}
+
+// styleOrder lists the CSS properties that are written before any other properties, in the order in which they are written.
+var styleOrder = []string{"color", "background-color", "font-size", "text-align"}
+
+// styleLess says if the style declaration a should be written before b. Declarations of the properties in styleOrder
+// come first in that order, and the rest are ordered alphabetically.
+func styleLess(a, b string) bool {
+	ra, rb := styleRank(a), styleRank(b)
+	if ra != rb {
+		return ra < rb
+	}
+	return a < b
+}
+
+// styleRank gives the position in styleOrder of the property in the style declaration decl, or len(styleOrder) if the
+// property is not listed.
+func styleRank(decl string) int {
+	prop := decl
+	if i := strings.IndexByte(decl, ':'); i != -1 {
+		prop = strings.TrimSpace(decl[:i])
+	}
+	for i := range styleOrder {
+		if styleOrder[i] == prop {
+			return i
+		}
+	}
+	return len(styleOrder)
+}
@@ -3,6 +3,7 @@ package quill
 import (
 	"bytes"
 	"sort"
+	"strings"
 	"testing"
 )
 
@@ -99,12 +100,12 @@ func TestFormatState_closePrevious(t *testing.T) {
 
 	cases := []formatState{
 		{
-			{"em", Tag, false, false, "", "", o1.getFormatter("italic", nil)},
-			{"strong", Tag, false, false, "", "", o1.getFormatter("bold", nil)},
+			{"em", Tag, false, nil, false, "", "", o1.getFormatter("italic", nil)},
+			{"strong", Tag, false, nil, false, "", "", o1.getFormatter("bold", nil)},
 		},
 		{
-			{"background-color:#e0e0e0;", Style, false, false, "", "", o2.getFormatter("background", nil)},
-			{"em", Tag, false, false, "", "", o2.getFormatter("italic", nil)},
+			{"background-color:#e0e0e0;", Style, false, nil, false, "", "", o2.getFormatter("background", nil)},
+			{"em", Tag, false, nil, false, "", "", o2.getFormatter("italic", nil)},
 		},
 	}
 
@@ -128,6 +129,59 @@ func TestFormatState_closePrevious(t *testing.T) {
 
 }
 
+func TestFormatState_minimalClosing(t *testing.T) {
+
+	cases := []struct {
+		ops         string
+		want        string
+		tag         string
+		opens       int
+		description string
+	}{
+		{
+			ops: `[{"attributes":{"bold":true},"insert":"a"},{"attributes":{"bold":true,"italic":true},"insert":"b"},
+				{"attributes":{"bold":true,"underline":true},"insert":"c"},{"attributes":{"bold":true},"insert":"d"},{"insert":"\n"}]`,
+			want:        "<p><strong>a<em>b</em><u>c</u>d</strong></p>",
+			tag:         "<strong>",
+			opens:       1,
+			description: "run sharing bold",
+		},
+		{
+			ops: `[{"attributes":{"italic":true},"insert":"a"},{"attributes":{"italic":true,"underline":true},"insert":"b"},
+				{"attributes":{"italic":true,"underline":true,"bold":true},"insert":"c"},{"attributes":{"underline":true,"bold":true},"insert":"d"},
+				{"insert":"\n"}]`,
+			want:        "<p><em>a<u>b<strong>c</strong></u></em><u><strong>d</strong></u></p>",
+			tag:         "<u>",
+			opens:       2,
+			description: "reopened in original order",
+		},
+		{
+			ops: `[{"attributes":{"link":"https://widerwebs.com"},"insert":"a"},
+				{"attributes":{"link":"https://widerwebs.com","bold":true},"insert":"b"},{"insert":"\n"}]`,
+			want:        `<p><a href="https://widerwebs.com" target="_blank">a<strong>b</strong></a></p>`,
+			tag:         "<a ",
+			opens:       1,
+			description: "run sharing a link",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.description, func(t *testing.T) {
+			got, err := Render([]byte(tc.ops))
+			if err != nil {
+				t.Fatalf("%s", err)
+			}
+			if string(got) != tc.want {
+				t.Errorf("bad rendering; got: %s", got)
+			}
+			if n := strings.Count(string(got), tc.tag); n != tc.opens {
+				t.Errorf("expected %q to be opened %d times but it was opened %d times", tc.tag, tc.opens, n)
+			}
+		})
+	}
+
+}
+
 func TestFormatState_Sort(t *testing.T) {
 
 	o := &Op{
@@ -170,13 +224,13 @@ func TestFormatState_Sort(t *testing.T) {
 			{"strong", Tag, "bold"},
 		},
 		{
+			{"align-center", Class, "align"},
 			{"strong", Tag, "bold"},
 			{"u", Tag, "underline"},
-			{"align-center", Class, "align"},
 		},
 		{
-			{"em", Tag, "italic"},
 			{"color:#e0e0e0;", Style, "color"},
+			{"em", Tag, "italic"},
 		},
 		{
 			{`<a href="https://widerwebs.com" target="_blank">`, Tag, "link"}, // link wrapper
@@ -0,0 +1,53 @@
+package quill
+
+import (
+	"io/ioutil"
+	"testing"
+)
+
+func FuzzRender(f *testing.F) {
+
+	for _, n := range []string{"ops1", "nested", "ordering", "list1", "list2", "list3", "list4", "indent", "code1", "code2"} {
+		ops, err := ioutil.ReadFile("./testdata/" + n + ".json")
+		if err != nil {
+			f.Fatalf("could not read %s.json; %s", n, err)
+		}
+		f.Add(ops)
+	}
+	f.Add([]byte(`[{"insert":"a"},{"attributes":{"table":"row-1"},"insert":"\n"}]`))
+	f.Add([]byte(`[{"insert":{"image":"x"}},{"insert":"text\n","attributes":{"indent":99,"list":"ordered"}}]`))
+	f.Add([]byte("[{\"insert\":\"\xff\xfe\\n\"}]"))
+
+	f.Add([]byte(`{"ops":[{"insert":{"formula":"x_i^{2} \\frac{a}{b}"}},` +
+		`{"insert":"a ---"},{"attributes":{"foo":"1","caption":"c"},"insert":{"image":"data:image/png;base64,AA"}},` +
+		`{"attributes":{"id":"x","code-block":"go"},"insert":"\n"}]}`))
+
+	// The options that take the most distinct paths through the renderer.
+	opts := Options{
+		Sanitize:          DefaultAllowlist(),
+		DataAttrs:         true,
+		Dividers:          true,
+		SoftBreaks:        true,
+		AutoLink:          true,
+		FormulaMathML:     true,
+		ImageCaptions:     true,
+		BlockIDs:          true,
+		FirstLineAsTitle:  true,
+		ContinueLists:     true,
+		LooseLists:        true,
+		TrimTrailingSpace: true,
+		TabWidth:          4,
+		EmptyLineMode:     EmptyLineCollapse,
+		UnknownTypePolicy: UnknownTypeRaw,
+		Footnotes:         new(FootnoteCollector),
+		DocumentDirection: "rtl",
+	}
+
+	f.Fuzz(func(t *testing.T, ops []byte) {
+		// Any input must render without panicking, whether or not it is a valid delta.
+		RenderExtended(ops, nil)
+		RenderWithOptions(ops, opts)
+		RenderTo(ioutil.Discard, ops, opts)
+	})
+
+}
@@ -1,14 +1,27 @@
 package quill
 
 import (
+	"bytes"
+	"encoding/json"
+	"html"
 	"io"
-	"strconv"
+	"net/url"
+	"regexp"
+	"strings"
 )
 
 // bold
-type boldFormat struct{}
+type boldFormat struct {
+	presentational bool // write a "b" tag instead of "strong"
+}
 
-func (*boldFormat) Fmt() *Format {
+func (bf *boldFormat) Fmt() *Format {
+	if bf.presentational {
+		return &Format{
+			Val:   "b",
+			Place: Tag,
+		}
+	}
 	return &Format{
 		Val:   "strong",
 		Place: Tag,
@@ -20,9 +33,17 @@ func (*boldFormat) HasFormat(o *Op) bool {
 }
 
 // italic
-type italicFormat struct{}
+type italicFormat struct {
+	presentational bool // write an "i" tag instead of "em"
+}
 
-func (*italicFormat) Fmt() *Format {
+func (inf *italicFormat) Fmt() *Format {
+	if inf.presentational {
+		return &Format{
+			Val:   "i",
+			Place: Tag,
+		}
+	}
 	return &Format{
 		Val:   "em",
 		Place: Tag,
@@ -47,12 +68,109 @@ func (*underlineFormat) HasFormat(o *Op) bool {
 	return o.HasAttr("underline")
 }
 
+// keyboard input
+type keyboardFormat struct{}
+
+func (*keyboardFormat) Fmt() *Format {
+	return &Format{
+		Val:   "kbd",
+		Place: Tag,
+	}
+}
+
+func (*keyboardFormat) HasFormat(o *Op) bool {
+	return o.HasAttr("keyboard")
+}
+
+// abbreviation (the value of the attribute is the expansion)
+type abbrFormat struct {
+	title string
+}
+
+func (af *abbrFormat) Fmt() *Format {
+	return &Format{
+		Val:   "abbr",
+		Place: Tag,
+		Attrs: map[string]string{"title": af.title},
+	}
+}
+
+func (af *abbrFormat) HasFormat(o *Op) bool {
+	return o.Attrs["abbr"] == af.title
+}
+
+// highlight
+type markFormat struct{}
+
+func (*markFormat) Fmt() *Format {
+	return &Format{
+		Val:   "mark",
+		Place: Tag,
+	}
+}
+
+func (*markFormat) HasFormat(o *Op) bool {
+	return o.HasAttr("mark")
+}
+
+// an attribute that no format is defined for, kept as a data attribute
+type dataAttrFormat struct {
+	attr, val string
+}
+
+// newDataAttrFormat returns a format for the attribute, or nil if the attribute name cannot be used in the name of an HTML
+// data attribute.
+func newDataAttrFormat(attr, val string) *dataAttrFormat {
+	if attr == "" {
+		return nil
+	}
+	for _, r := range attr {
+		if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.') {
+			return nil
+		}
+	}
+	return &dataAttrFormat{attr, val}
+}
+
+func (df *dataAttrFormat) Fmt() *Format {
+	return &Format{
+		Val:   "span",
+		Place: Tag,
+		Attrs: map[string]string{"data-" + df.attr: df.val},
+	}
+}
+
+func (df *dataAttrFormat) HasFormat(o *Op) bool {
+	return o.Attrs[df.attr] == df.val
+}
+
+// inline code
+type codeFormat struct{}
+
+func (*codeFormat) Fmt() *Format {
+	return &Format{
+		Val:   "code",
+		Place: Tag,
+	}
+}
+
+func (*codeFormat) HasFormat(o *Op) bool {
+	return o.HasAttr("code")
+}
+
 // text color
 type colorFormat struct {
-	c string
+	c     string
+	class bool // whether to write a class (as Quill does for a palette of named colors) instead of a style
 }
 
 func (cf *colorFormat) Fmt() *Format {
+	if cf.class {
+		return &Format{
+			Val:   "ql-color-" + cf.c,
+			Place: Class,
+		}
+	}
 	return &Format{
 		Val:   "color:" + cf.c + ";",
 		Place: Style,
@@ -65,7 +183,10 @@ func (cf *colorFormat) HasFormat(o *Op) bool {
 
 // link
 type linkFormat struct {
-	href string
+	href   string
+	base   string // the URL against which a relative href is resolved (optional)
+	button bool   // whether the link is styled as a button (by the "button" attribute)
+	rel    string // the rel attribute of the link (optional)
 }
 
 func (*linkFormat) Fmt() *Format { return new(Format) } // Only a wrapper.
@@ -75,20 +196,114 @@ func (lf *linkFormat) HasFormat(*Op) bool {
 }
 
 func (lf *linkFormat) Wrap() (string, string) {
-	return `<a href=` + strconv.Quote(lf.href) + ` target="_blank">`, "</a>"
+	pre := "<a"
+	if lf.button {
+		pre += ` class="btn"`
+	}
+	return pre + ` href=` + quoteAttr(sanitizeHref(resolveURL(lf.base, lf.href))) + ` target="_blank"` + relAttr(lf.rel) + `>`, "</a>"
 }
 
-func (lf *linkFormat) Open(_ []*Format, _ *Op) bool {
-	return true // This format will only appear when there is a "link" attribute set.
+func (lf *linkFormat) Open(open []*Format, _ *Op) bool {
+	// This format will only appear when there is a "link" attribute set, so open it unless the same link is already open.
+	for i := range open {
+		if l, ok := open[i].fm.(*linkFormat); ok && l.href == lf.href && l.button == lf.button {
+			return false
+		}
+	}
+	return true
 }
 
 func (lf *linkFormat) Close(_ []*Format, o *Op, _ bool) bool {
-	return o.Attrs["link"] != lf.href
+	return o.Attrs["link"] != lf.href || o.HasAttr("button") != lf.button
+}
+
+// linkSchemes lists the URL schemes allowed in links (the same as Quill allows).
+var linkSchemes = []string{"http", "https", "mailto", "tel"}
+
+// sanitizedHref replaces the URLs of links that are not allowed.
+const sanitizedHref = "about:blank"
+
+// sanitizeHref returns href if it is a relative URL (including a fragment-only URL such as "#top") or an absolute URL
+// with a scheme in linkSchemes, and sanitizedHref otherwise.
+func sanitizeHref(href string) string {
+	u, err := url.Parse(strings.TrimSpace(href))
+	if err != nil {
+		return sanitizedHref
+	}
+	if u.Scheme == "" {
+		return href
+	}
+	for _, s := range linkSchemes {
+		if strings.EqualFold(u.Scheme, s) {
+			return href
+		}
+	}
+	return sanitizedHref
+}
+
+// autoLinkURL matches the URLs that are linked with the AutoLink option.
+var autoLinkURL = regexp.MustCompile(`https?://[^\s<>"]+`)
+
+// writeAutoLinked writes s to buf with each URL in it wrapped in a link like the ones that linkFormat writes. The text is
+// escaped with the escape function. Punctuation at the end of a URL is taken to be part of the sentence around it.
+func writeAutoLinked(buf *bytes.Buffer, s string, escape func(string) string, rel string) {
+	written := 0 // the length of s that has been written
+	for _, loc := range autoLinkURL.FindAllStringIndex(s, -1) {
+		link := strings.TrimRight(s[loc[0]:loc[1]], ".,;:!?)'")
+		if strings.HasSuffix(link, "://") {
+			continue // There is only a scheme.
+		}
+		writeText(buf, escape(s[written:loc[0]]))
+		buf.WriteString(`<a href=` + quoteAttr(sanitizeHref(link)) + ` target="_blank"` + relAttr(rel) + `>`)
+		writeText(buf, escape(link))
+		buf.WriteString("</a>")
+		written = loc[0] + len(link)
+	}
+	writeText(buf, escape(s[written:]))
+}
+
+// relAttr gives the rel attribute to write on links, if rel is set.
+func relAttr(rel string) string {
+	if rel == "" {
+		return ""
+	}
+	return ` rel=` + quoteAttr(rel)
+}
+
+// resolveURL resolves the URL ref against the URL base. If base is blank, ref is only a fragment (as a link to a part of
+// the document), or either URL is invalid, ref is returned as it is.
+func resolveURL(base, ref string) string {
+	if base == "" || strings.HasPrefix(ref, "#") {
+		return ref
+	}
+	b, err := url.Parse(base)
+	if err != nil {
+		return ref
+	}
+	r, err := url.Parse(strings.TrimSpace(ref))
+	if err != nil || r.IsAbs() {
+		return ref // An absolute URL (such as a data URL) is written exactly as given.
+	}
+	return b.ResolveReference(r).String()
 }
 
 // image
 type imageFormat struct {
 	src, alt string
+	base     string // the URL against which a relative src is resolved (optional)
+	caption  string // if not blank, the image is written in a figure with this caption
+	lazy     bool   // add loading="lazy" and decoding="async"
+
+	width, height string // the dimensions given by the "width" and "height" attributes (optional)
+	sizeStyle     bool   // whether to write the dimensions in a style attribute
+
+	placeholder string // if not blank, the HTML written instead of the image (whose data URL is rejected)
+}
+
+// isDataURL says if the URL is a data URL, which holds the content itself (such as a pasted image).
+func isDataURL(u string) bool {
+	u = strings.TrimSpace(u)
+	return len(u) >= 5 && strings.EqualFold(u[:5], "data:")
 }
 
 func (*imageFormat) Fmt() *Format { return nil } // The body contains the entire element.
@@ -99,15 +314,111 @@ func (imf *imageFormat) HasFormat(o *Op) bool {
 
 // imageFormat implements the FormatWriter interface.
 func (imf *imageFormat) Write(buf io.Writer) {
+	if imf.placeholder != "" {
+		io.WriteString(buf, imf.placeholder)
+		return
+	}
 	io.WriteString(buf, "<img src=")
-	io.WriteString(buf, strconv.Quote(imf.src))
+	io.WriteString(buf, quoteAttr(resolveURL(imf.base, imf.src)))
 	if imf.alt != "" {
 		io.WriteString(buf, " alt=")
-		io.WriteString(buf, strconv.Quote(imf.alt))
+		io.WriteString(buf, quoteAttr(imf.alt))
+	}
+	imf.writeSize(buf)
+	if imf.lazy {
+		io.WriteString(buf, ` loading="lazy" decoding="async"`)
 	}
 	buf.Write([]byte{'>'})
 }
 
+// figcaption gives the caption of the image if it is written in a figure (which writeInline writes around it), or "".
+func (imf *imageFormat) figcaption() string {
+	if imf.placeholder != "" {
+		return ""
+	}
+	return imf.caption
+}
+
+// writeSize writes the attributes that give the dimensions of the image. A number is a length in pixels. As HTML
+// attributes, only numbers can be written; in a style attribute, any CSS length (such as "50%") can be. Other values
+// are left out.
+func (imf *imageFormat) writeSize(buf io.Writer) {
+	var style string
+	for _, d := range [2]struct{ name, val string }{{"width", imf.width}, {"height", imf.height}} {
+		isNum := d.val != "" && strings.Trim(d.val, "0123456789") == ""
+		switch {
+		case imf.sizeStyle && isNum:
+			style += d.name + ":" + d.val + "px;"
+		case imf.sizeStyle && cssLength.MatchString(d.val):
+			style += d.name + ":" + d.val + ";"
+		case !imf.sizeStyle && isNum:
+			io.WriteString(buf, " "+d.name+"="+quoteAttr(d.val))
+		}
+	}
+	if style != "" {
+		io.WriteString(buf, " style="+quoteAttr(style))
+	}
+}
+
+// mention (an embed inserted by the quill-mention module)
+type mentionFormat struct {
+	id, value, denotation string
+	render                func(id, value, denotation string) string // optional
+}
+
+// newMentionFormat reads the properties of the mention embed given as JSON in data.
+func newMentionFormat(data string, render func(id, value, denotation string) string) *mentionFormat {
+	var m struct {
+		ID         string `json:"id"`
+		Value      string `json:"value"`
+		Denotation string `json:"denotationChar"`
+	}
+	json.Unmarshal([]byte(data), &m) // A malformed mention just has blank properties.
+	return &mentionFormat{m.ID, m.Value, m.Denotation, render}
+}
+
+func (*mentionFormat) Fmt() *Format { return nil } // The body contains the entire element.
+
+func (mf *mentionFormat) HasFormat(o *Op) bool {
+	return o.Type == "mention"
+}
+
+// mentionFormat implements the FormatWriter interface.
+func (mf *mentionFormat) Write(buf io.Writer) {
+	if mf.render != nil {
+		io.WriteString(buf, mf.render(mf.id, mf.value, mf.denotation))
+		return
+	}
+	io.WriteString(buf, `<span class="mention" data-denotation-char=`+quoteAttr(mf.denotation)+` data-id=`+quoteAttr(mf.id)+
+		` data-value=`+quoteAttr(mf.value)+`><span class="ql-mention-denotation-char">`+html.EscapeString(mf.denotation)+
+		`</span>`+html.EscapeString(mf.value)+`</span>`)
+}
+
+// formula (an embed with TeX source)
+type formulaFormat struct {
+	tex    string
+	mathML bool // write a <math> element instead of a span for KaTeX
+}
+
+func (*formulaFormat) Fmt() *Format { return nil } // The body contains the entire element.
+
+func (ff *formulaFormat) HasFormat(o *Op) bool {
+	return o.Type == "formula" && o.Data == ff.tex
+}
+
+// formulaFormat implements the FormatWriter interface. By default, the formula is written like Quill writes it before
+// KaTeX renders it in the browser. The MathML form is converted from the TeX source (see texToMathML), which is kept as
+// an annotation so that it can be processed further.
+func (ff *formulaFormat) Write(buf io.Writer) {
+	tex := html.EscapeString(ff.tex)
+	if ff.mathML {
+		io.WriteString(buf, `<math><semantics><mrow>`+texToMathML(ff.tex)+`</mrow><annotation encoding="application/x-tex">`+
+			tex+`</annotation></semantics></math>`)
+		return
+	}
+	io.WriteString(buf, `<span class="ql-formula" data-value=`+quoteAttr(ff.tex)+`>`+tex+`</span>`)
+}
+
 // strikethrough
 type strikeFormat struct{}
 
@@ -124,10 +435,17 @@ func (*strikeFormat) HasFormat(o *Op) bool {
 
 // background
 type bkgFormat struct {
-	c string
+	c     string
+	class bool // whether to write a class (as Quill does for a palette of named colors) instead of a style
 }
 
 func (bf *bkgFormat) Fmt() *Format {
+	if bf.class {
+		return &Format{
+			Val:   "ql-bg-" + bf.c,
+			Place: Class,
+		}
+	}
 	return &Format{
 		Val:   "background-color:" + bf.c + ";",
 		Place: Style,
@@ -138,10 +456,22 @@ func (bf *bkgFormat) HasFormat(o *Op) bool {
 	return o.Attrs["background"] == bf.c
 }
 
-// sizeFormat is used for inline strings of named sizes such as "huge" or "small".
+// sizeFormat is used for inline strings of named sizes such as "huge" or "small" or of CSS lengths such as "16px".
 type sizeFormat string
 
+// cssLength matches the CSS lengths allowed as sizes.
+var cssLength = regexp.MustCompile(`^\d+(?:\.\d+)?(?:px|em|rem|pt|pc|%|ex|ch|vw|vh|vmin|vmax|cm|mm|in)$`)
+
 func (sf sizeFormat) Fmt() *Format {
+	if sf != "" && sf[0] >= '0' && sf[0] <= '9' { // Quill's style attributor for sizes gives lengths.
+		if !cssLength.MatchString(string(sf)) {
+			return nil // Not a valid length, so possibly an attempt to inject other styles.
+		}
+		return &Format{
+			Val:   "font-size:" + string(sf) + ";",
+			Place: Style,
+		}
+	}
 	return &Format{
 		Val:   "ql-size-" + string(sf),
 		Place: Class,
@@ -165,6 +495,6 @@ func (sf *scriptFormat) Fmt() *Format {
 	}
 }
 
-func (*scriptFormat) HasFormat(o *Op) bool {
-	return o.HasAttr("script")
+func (sf *scriptFormat) HasFormat(o *Op) bool {
+	return o.HasAttr("script") && (o.Attrs["script"] == "super") == (sf.t == "sup")
 }
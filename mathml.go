@@ -0,0 +1,189 @@
+package quill
+
+import (
+	"html"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// texLetters maps the TeX commands for Greek letters (and other symbols written as identifiers) to their characters.
+var texLetters = map[string]string{
+	"alpha": "α", "beta": "β", "gamma": "γ", "delta": "δ", "epsilon": "ϵ", "varepsilon": "ε", "zeta": "ζ", "eta": "η",
+	"theta": "θ", "iota": "ι", "kappa": "κ", "lambda": "λ", "mu": "μ", "nu": "ν", "xi": "ξ", "pi": "π", "rho": "ρ",
+	"sigma": "σ", "tau": "τ", "upsilon": "υ", "phi": "ϕ", "varphi": "φ", "chi": "χ", "psi": "ψ", "omega": "ω",
+	"Gamma": "Γ", "Delta": "Δ", "Theta": "Θ", "Lambda": "Λ", "Xi": "Ξ", "Pi": "Π", "Sigma": "Σ", "Phi": "Φ", "Psi": "Ψ",
+	"Omega": "Ω", "infty": "∞", "partial": "∂", "nabla": "∇", "ell": "ℓ",
+}
+
+// texOperators maps the TeX commands for operators and relations to their characters.
+var texOperators = map[string]string{
+	"times": "×", "cdot": "⋅", "div": "÷", "pm": "±", "mp": "∓", "leq": "≤", "le": "≤", "geq": "≥", "ge": "≥",
+	"neq": "≠", "ne": "≠", "approx": "≈", "equiv": "≡", "sim": "∼", "to": "→", "rightarrow": "→", "leftarrow": "←",
+	"Rightarrow": "⇒", "Leftrightarrow": "⇔", "in": "∈", "notin": "∉", "subset": "⊂", "cup": "∪", "cap": "∩",
+	"sum": "∑", "prod": "∏", "int": "∫", "forall": "∀", "exists": "∃", "ldots": "…", "cdots": "⋯",
+}
+
+// maxTeXDepth limits the nesting of the parts of a formula that texToMathML converts. The rest of a formula that is
+// nested more deeply is written as text.
+const maxTeXDepth = 32
+
+// texToMathML converts the TeX source of a formula into the MathML elements of a <math> element. Only a small part of
+// TeX is understood: letters, numbers, operators, groups in braces, subscripts and superscripts, \frac, \sqrt, and the
+// commands in texLetters and texOperators. Any other command is written as text.
+func texToMathML(tex string) string {
+	p := texParser{s: tex}
+	var b strings.Builder
+	for p.i < len(p.s) {
+		p.row(&b, 0)
+		if p.i < len(p.s) { // An unmatched "}".
+			b.WriteString("<mo>}</mo>")
+			p.i++
+		}
+	}
+	return b.String()
+}
+
+// A texParser reads the TeX source s of a formula from index i.
+type texParser struct {
+	s string
+	i int
+}
+
+// row writes the elements up to the end of the current group (a "}") or of the source.
+func (p *texParser) row(b *strings.Builder, depth int) {
+	for {
+		p.skipSpace()
+		if p.i == len(p.s) || p.s[p.i] == '}' {
+			return
+		}
+		p.script(b, depth)
+	}
+}
+
+// script writes an element along with its subscript and superscript, if it has any.
+func (p *texParser) script(b *strings.Builder, depth int) {
+
+	var base, sub, sup strings.Builder
+	p.atom(&base, depth)
+
+	for {
+		p.skipSpace()
+		if p.i == len(p.s) || (p.s[p.i] != '_' && p.s[p.i] != '^') {
+			break
+		}
+		arg := &sup
+		if p.s[p.i] == '_' {
+			arg = &sub
+		}
+		p.i++
+		p.skipSpace()
+		arg.Reset()
+		p.atom(arg, depth+1)
+	}
+
+	switch {
+	case sub.Len() > 0 && sup.Len() > 0:
+		b.WriteString("<msubsup>" + base.String() + sub.String() + sup.String() + "</msubsup>")
+	case sub.Len() > 0:
+		b.WriteString("<msub>" + base.String() + sub.String() + "</msub>")
+	case sup.Len() > 0:
+		b.WriteString("<msup>" + base.String() + sup.String() + "</msup>")
+	default:
+		b.WriteString(base.String())
+	}
+
+}
+
+// atom writes a single element: a group, a command, a number, an identifier, or an operator. If there is none (as at
+// the end of a group), an empty <mrow> is written.
+func (p *texParser) atom(b *strings.Builder, depth int) {
+
+	if p.i == len(p.s) || strings.IndexByte("}^_", p.s[p.i]) != -1 {
+		b.WriteString("<mrow></mrow>")
+		return
+	}
+
+	if depth > maxTeXDepth {
+		b.WriteString("<mtext>" + html.EscapeString(p.s[p.i:]) + "</mtext>")
+		p.i = len(p.s)
+		return
+	}
+
+	switch c := p.s[p.i]; {
+	case c == '{':
+		p.i++
+		b.WriteString("<mrow>")
+		p.row(b, depth+1)
+		b.WriteString("</mrow>")
+		if p.i < len(p.s) {
+			p.i++ // the "}"
+		}
+	case c == '\\':
+		p.command(b, depth)
+	case c >= '0' && c <= '9' || c == '.':
+		start := p.i
+		for p.i < len(p.s) && (p.s[p.i] >= '0' && p.s[p.i] <= '9' || p.s[p.i] == '.') {
+			p.i++
+		}
+		b.WriteString("<mn>" + p.s[start:p.i] + "</mn>")
+	default:
+		r, n := utf8.DecodeRuneInString(p.s[p.i:])
+		p.i += n
+		if unicode.IsLetter(r) {
+			b.WriteString("<mi>" + html.EscapeString(string(r)) + "</mi>")
+		} else {
+			b.WriteString("<mo>" + html.EscapeString(string(r)) + "</mo>")
+		}
+	}
+
+}
+
+// command writes the element given by the command that starts at the "\" at index i.
+func (p *texParser) command(b *strings.Builder, depth int) {
+
+	p.i++ // the "\"
+	start := p.i
+	for p.i < len(p.s) && (p.s[p.i] >= 'a' && p.s[p.i] <= 'z' || p.s[p.i] >= 'A' && p.s[p.i] <= 'Z') {
+		p.i++
+	}
+	name := p.s[start:p.i]
+
+	switch {
+	case name == "" && p.i < len(p.s):
+		// An escaped character (such as "\{") or a space (such as "\,"), which is left out.
+		r, n := utf8.DecodeRuneInString(p.s[p.i:])
+		p.i += n
+		if !strings.ContainsRune(" ,:;!", r) {
+			b.WriteString("<mo>" + html.EscapeString(string(r)) + "</mo>")
+		}
+	case name == "frac":
+		b.WriteString("<mfrac>")
+		p.skipSpace()
+		p.atom(b, depth+1)
+		p.skipSpace()
+		p.atom(b, depth+1)
+		b.WriteString("</mfrac>")
+	case name == "sqrt":
+		b.WriteString("<msqrt>")
+		p.skipSpace()
+		p.atom(b, depth+1)
+		b.WriteString("</msqrt>")
+	case name == "left" || name == "right":
+		// The delimiter that follows is written as an operator.
+	case texLetters[name] != "":
+		b.WriteString("<mi>" + texLetters[name] + "</mi>")
+	case texOperators[name] != "":
+		b.WriteString("<mo>" + texOperators[name] + "</mo>")
+	default:
+		b.WriteString("<mtext>\\" + name + "</mtext>")
+	}
+
+}
+
+// skipSpace moves i past any white space.
+func (p *texParser) skipSpace() {
+	for p.i < len(p.s) && (p.s[p.i] == ' ' || p.s[p.i] == '\t' || p.s[p.i] == '\n' || p.s[p.i] == '\r') {
+		p.i++
+	}
+}
@@ -0,0 +1,35 @@
+package quill
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTexToMathML(t *testing.T) {
+
+	cases := map[string]string{
+		"x_1":                 "<msub><mi>x</mi><mn>1</mn></msub>",
+		"x_i^{2n}":            "<msubsup><mi>x</mi><mi>i</mi><mrow><mn>2</mn><mi>n</mi></mrow></msubsup>",
+		`\frac{a+1}{b}`:       "<mfrac><mrow><mi>a</mi><mo>+</mo><mn>1</mn></mrow><mrow><mi>b</mi></mrow></mfrac>",
+		`\sqrt 2 \leq \pi`:    "<msqrt><mn>2</mn></msqrt><mo>≤</mo><mi>π</mi>",
+		`\left( a<b \right)`:  "<mo>(</mo><mi>a</mi><mo>&lt;</mo><mi>b</mi><mo>)</mo>",
+		`\mathbb{R}\,\{\}`:    "<mtext>\\mathbb</mtext><mrow><mi>R</mi></mrow><mo>{</mo><mo>}</mo>",
+		"a}^":                 "<mi>a</mi><mo>}</mo><msup><mrow></mrow><mrow></mrow></msup>",
+		"3.14 ":               "<mn>3.14</mn>",
+		"":                    "",
+		"{{" + "\\frac" + "{": "<mrow><mrow><mfrac><mrow></mrow><mrow></mrow></mfrac></mrow></mrow>",
+	}
+
+	for tex, want := range cases {
+		if got := texToMathML(tex); got != want {
+			t.Errorf("(%q) expected %q but got %q", tex, want, got)
+		}
+	}
+
+	// Deeply nested groups are cut off as text.
+	got := texToMathML(strings.Repeat("{", 100) + "x")
+	if !strings.HasSuffix(got, "<mtext>"+strings.Repeat("{", 100-maxTeXDepth-1)+"x</mtext>"+strings.Repeat("</mrow>", maxTeXDepth+1)) {
+		t.Errorf("bad deep nesting: %q", got)
+	}
+
+}
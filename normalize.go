@@ -0,0 +1,80 @@
+package quill
+
+import (
+	"bytes"
+	"strings"
+)
+
+// blockTags lists the elements around which whitespace is insignificant.
+var blockTags = map[string]bool{
+	"blockquote": true, "details": true, "div": true, "figcaption": true, "figure": true, "h1": true, "h2": true, "h3": true,
+	"h4": true, "h5": true, "h6": true, "hr": true, "li": true, "ol": true, "p": true, "pre": true, "summary": true,
+	"table": true, "td": true, "tr": true, "ul": true,
+}
+
+// NormalizeHTML removes the insignificant whitespace from HTML (such as the output of Render that has been indented by
+// hand): whitespace at the start and end and whitespace between two tags of which at least one is the tag of a block
+// element. Whitespace in <pre> elements is kept. This way, HTML can be compared in tests without depending on layout.
+func NormalizeHTML(html []byte) []byte {
+
+	html = bytes.TrimSpace(html)
+	out := make([]byte, 0, len(html))
+
+	pre := 0 // the depth of open <pre> elements
+	for i := 0; i < len(html); {
+
+		if html[i] == '<' {
+			end := bytes.IndexByte(html[i:], '>')
+			if end == -1 {
+				return append(out, html[i:]...)
+			}
+			tag := html[i : i+end+1]
+			switch name, closing := tagName(tag); {
+			case name == "pre" && !closing:
+				pre++
+			case name == "pre" && closing && pre > 0:
+				pre--
+			}
+			out = append(out, tag...)
+			i += end + 1
+			continue
+		}
+
+		// Text up to the next tag.
+		next := bytes.IndexByte(html[i:], '<')
+		if next == -1 {
+			next = len(html) - i
+		}
+		text := html[i : i+next]
+		if pre == 0 && len(bytes.TrimSpace(text)) == 0 && i > 0 && i+next < len(html) {
+			before, _ := tagName(html[bytes.LastIndexByte(html[:i], '<'):i])
+			after, _ := tagName(html[i+next:])
+			if blockTags[before] || blockTags[after] {
+				text = nil // insignificant
+			}
+		}
+		out = append(out, text...)
+		i += next
+
+	}
+
+	return out
+
+}
+
+// tagName gives the lowercase name of the HTML tag at the start of b and whether it is a closing tag.
+func tagName(b []byte) (string, bool) {
+	if len(b) < 2 || b[0] != '<' {
+		return "", false
+	}
+	b = b[1:]
+	closing := b[0] == '/'
+	if closing {
+		b = b[1:]
+	}
+	end := bytes.IndexAny(b, " \t\n\r\f/>")
+	if end == -1 {
+		end = len(b)
+	}
+	return strings.ToLower(string(b[:end])), closing
+}
@@ -0,0 +1,17 @@
+package quill
+
+import "testing"
+
+func TestNormalizeHTML(t *testing.T) {
+
+	a := []byte("\n<ul>\n    <li>one <em>two</em> three</li>\n    <li>four</li>\n</ul>\n<pre>  code\n</pre>\n<p>a <b>b</b></p>\n")
+	b := []byte(`<ul><li>one <em>two</em> three</li>  <li>four</li></ul><pre>  code` + "\n" + `</pre> <p>a <b>b</b></p>`)
+
+	want := "<ul><li>one <em>two</em> three</li><li>four</li></ul><pre>  code\n</pre><p>a <b>b</b></p>"
+	for _, html := range [][]byte{a, b} {
+		if got := NormalizeHTML(html); string(got) != want {
+			t.Errorf("expected %q but got %q", want, got)
+		}
+	}
+
+}
@@ -0,0 +1,425 @@
+package quill
+
+import (
+	"bytes"
+	"html"
+	"strings"
+	"unicode"
+)
+
+// Options customizes the way RenderWithOptions renders a Delta. The zero value gives the built-in settings.
+type Options struct {
+	// CustomFormats, if set, may provide a Formatter to customize the way certain kinds of inserts are rendered.
+	// It works just like the function given to RenderExtended.
+	CustomFormats func(string, *Op) Formatter
+
+	// FormatMap, if set, maps keywords (insert types and attribute names) to functions that may provide a Formatter for
+	// ops with the keyword. It is consulted after CustomFormats and before the built-in formats.
+	FormatMap map[string]func(*Op) Formatter
+
+	// Overrides, if set, changes the Formats of built-in formats by keyword without a custom Formatter, such as to write
+	// bold text in <b> tags or block quotes as paragraphs with a class.
+	Overrides map[string]FormatOverride
+
+	// StripInvisible removes zero-width characters, byte order marks, and control characters (other than line feeds
+	// and tabs) from text inserts.
+	StripInvisible bool
+
+	// ChecklistCheckboxes renders the items of a checklist as list items that begin with a disabled checkbox input
+	// instead of in the way Quill marks up checklists (with a "data-checked" attribute on the list element).
+	ChecklistCheckboxes bool
+
+	// AriaRoles writes ARIA roles on lists and list items and heading roles and levels on headers for the sake of
+	// assistive technologies that do not recognize the semantics of the elements themselves.
+	AriaRoles bool
+
+	// HeadingOffset shifts the level of every header by the amount (such as 1 to write H1 headers as <h2>, to fit the
+	// headings of a page), keeping the levels from 1 to 6.
+	HeadingOffset int
+
+	// FirstLineAsTitle writes the first line of the document as its title, in a TitleTag element, regardless of the
+	// attributes of the line (as blog editors treat the first line as the title of a post). Empty lines before the title
+	// are left out. The id of the line is kept if BlockIDs is set.
+	FirstLineAsTitle bool
+
+	// TitleTag is the name of the element in which FirstLineAsTitle writes the title. By default (or if it is not a valid
+	// tag name), it is "h1".
+	TitleTag string
+
+	// ListAttrs, if set, gives HTML attributes (such as a class) to add to every <ul> and <ol> list element.
+	ListAttrs map[string]string
+
+	// ContinueLists makes an ordered list that is interrupted by other blocks (such as a paragraph) continue the numbering
+	// of the ordered list before it: the resumed <ol> element is given a start attribute.
+	ContinueLists bool
+
+	// LooseLists writes the content of each list item in a paragraph (as in <li><p>...</p></li>), as Markdown does for
+	// "loose" lists, instead of directly in the <li> element.
+	LooseLists bool
+
+	// DataAttrs keeps the attributes of text that no format is defined for as data attributes (such as data-foo for an
+	// attribute named foo) on a <span> element so that the information is not lost. Attributes with names that are not
+	// made of lowercase letters, digits, and "-", "_", or "." are left out.
+	DataAttrs bool
+
+	// AllowedClasses lists the class names that a "class" attribute on a line may add to the block element. Any other
+	// class names given by the attribute are ignored, so by default the attribute has no effect.
+	AllowedClasses []string
+
+	// PresentationalTags writes presentational tags instead of semantic tags for inline formats: "b" instead of "strong"
+	// for bold and "i" instead of "em" for italic. The tags for underline ("u"), strikethrough ("s"), subscript ("sub"),
+	// and superscript ("sup") are the same either way.
+	PresentationalTags bool
+
+	// Filter, if set, is called for each op before it is rendered, and the ops for which it returns false are omitted
+	// from the output. If an omitted op has a line feed that ends a line, then the whole line is omitted.
+	Filter func(*Op) bool
+
+	// KeyboardAndMark enables the "keyboard" attribute, written as <kbd>, and the "mark" attribute, written as <mark>.
+	// These formats are not built into Quill, so they are off by default to not conflict with custom formats.
+	KeyboardAndMark bool
+
+	// Details enables the "details" attribute of lines: consecutive lines with the attribute are written in a <details>
+	// element, with the first line as its <summary> and the other lines as paragraphs. This format is not built into
+	// Quill, so it is off by default.
+	Details bool
+
+	// Abbreviations enables the "abbr" attribute, whose value is the expansion of the text: the text is written in an
+	// <abbr> element with the value as its title. This format is not built into Quill, so it is off by default.
+	Abbreviations bool
+
+	// BlockIDs enables the "id" attribute of lines (as collaborative editors set to identify blocks): the value is written
+	// as the id of the block element if it consists only of ASCII letters, digits, "-", and "_" and begins with a letter.
+	BlockIDs bool
+
+	// CodeLineNumbers writes each line of a code block in a <span class="line"> element so that the lines can be numbered
+	// with a CSS counter (as in documentation pages).
+	CodeLineNumbers bool
+
+	// ColorClasses writes text colors and background colors as classes (such as "ql-color-red" and "ql-bg-blue") instead
+	// of as inline styles, for deployments of Quill that are configured with a fixed palette of colors.
+	ColorClasses bool
+
+	// MaxIndentDepth, if positive, limits the indent amount of lines (including list items and block quotes); deeper
+	// indents are rendered at this depth. By default, list items and code block lines are nested at most five levels deep
+	// (more deeply indented ones are not nested at all), and the indent class of a line is not limited.
+	MaxIndentDepth int
+
+	// MentionRenderer, if set, gives the HTML to write for a mention embed (as inserted by the quill-mention module) with
+	// the ID, value, and denotation character of the mention. The HTML is written as given, so any text in it must be
+	// escaped. By default, mentions are written in the same markup that quill-mention uses.
+	MentionRenderer func(id, value, denotation string) string
+
+	// FormulaMathML writes formula embeds as <math> elements instead of as spans to be rendered by KaTeX. Only a basic
+	// part of TeX (letters, numbers, operators, scripts, fractions, roots, and Greek letters) is converted to MathML;
+	// other commands are written as text.
+	FormulaMathML bool
+
+	// PreserveLeadingSpaces writes the spaces at the start of each line (except in code blocks) as non-breaking spaces so
+	// that browsers do not collapse them and indentation made with spaces is kept.
+	PreserveLeadingSpaces bool
+
+	// TrimTrailingSpace removes the whitespace at the end of each line (before the line feed that ends a block or, with
+	// SoftBreaks, before a line break), which editors sometimes leave behind. Code blocks, which are preformatted, are not
+	// trimmed.
+	TrimTrailingSpace bool
+
+	// TabWidth, if positive, writes each tab in text (except in code blocks, which are preformatted) as this many
+	// non-breaking spaces so that browsers do not collapse it.
+	TabWidth int
+
+	// Dividers writes each paragraph that consists only of "---" or "***" (without any inline or block formats, such as
+	// an alignment) as an <hr> element, as Markdown does.
+	Dividers bool
+
+	// SoftBreaks handles line feeds like Markdown does: consecutive lines of plain paragraphs are joined in a single
+	// paragraph with <br> line breaks, and an empty line starts a new paragraph. Lines with block formats (such as
+	// headers and list items) are not affected. When a Stream is used, the line feeds in each part are handled separately.
+	SoftBreaks bool
+
+	// TextEscaper, if set, escapes the text of ops before it is written instead of html.EscapeString. It can be used to
+	// escape text for a different output context or to add markup (such as links) to text; whatever it returns is written
+	// as given.
+	TextEscaper func(string) string
+
+	// AutoLink wraps the http and https URLs found in text in links (after the text around them is escaped). Text that
+	// already has a link is left as it is.
+	AutoLink bool
+
+	// LinkRel, if set, is written as the rel attribute of every link (including the links made by AutoLink), such as
+	// "ugc nofollow" for user-generated content so that search engines do not credit the linked pages.
+	LinkRel string
+
+	// BaseURL, if set, is the URL against which the relative URLs of links and images are resolved. URLs that cannot be
+	// parsed are written as they are.
+	BaseURL string
+
+	// LazyImages adds loading="lazy" and decoding="async" attributes to images so that browsers can defer loading and
+	// decoding them.
+	LazyImages bool
+
+	// DataImagePlaceholder, if set, rejects images with data URLs (such as images pasted into the editor, which can be
+	// very large) and writes this HTML in place of each of them. By default, data URLs are written as they are.
+	DataImagePlaceholder string
+
+	// ImageSizeMode says how the dimensions of images (given by the "width" and "height" attributes, as set by image
+	// resizing modules) are written.
+	ImageSizeMode ImageSizeMode
+
+	// ImageCaptions writes each image that has a "caption" attribute in a <figure> element, with the caption in a
+	// <figcaption> element. A figure is not written inside of a paragraph or a header: the text of the line before and
+	// after it is written in elements of its own.
+	ImageCaptions bool
+
+	// StyleNonce, if set, makes the output work with a Content-Security-Policy that blocks inline style attributes. Each
+	// style is written as a generated class, and the rules of the classes are written at the end of the document in a
+	// <style> element with StyleNonce as its nonce attribute.
+	StyleNonce string
+
+	// EmptyLineMode says how an empty line (paragraph) is written.
+	EmptyLineMode EmptyLineMode
+
+	// Container, if set, is the name of an element (such as "article") that the whole document is written in. A name that
+	// is not a valid tag name is replaced with "div".
+	Container string
+
+	// DocumentDirection, if set to "rtl", "ltr", or "auto", is written as the dir attribute of the Container so that the
+	// whole document has the direction without an attribute on each block. If Container is not set, a <div> is used.
+	DocumentDirection string
+
+	// EmptyDocument is written for a Delta without any ops (an empty array), such as "<p><br></p>" to match the empty
+	// state of an editor. By default, nothing is written. (A Delta with a single line feed is rendered as usual.)
+	EmptyDocument string
+
+	// Footnotes, if set, renders the text marked with its attribute as footnote references and writes the footnotes at
+	// the end of the document (before DocumentEnd is called).
+	Footnotes *FootnoteCollector
+
+	// DocumentEnd, if set, is called with the output buffer after the whole document has been written so that content
+	// (such as a list of footnotes) can be appended.
+	DocumentEnd func(dst *bytes.Buffer)
+
+	// UnknownTypePolicy says how an op with an insert type for which there is no format is handled. By default, the
+	// render stops with an error.
+	UnknownTypePolicy UnknownTypePolicy
+
+	// EmojiShortcodes, if set, maps shortcode names (such as "smile") to the emoji that replace the shortcodes (such as
+	// ":smile:") in text, except in code blocks. Shortcodes that are not in the map are left as they are.
+	EmojiShortcodes map[string]string
+
+	// Debug, if set, is called at key points of a render with a description of the event and the current op: "format X"
+	// when a Formatter is found for the type or attribute X of an op, and "open T" and "close T" when the tag T of a block
+	// element is written. It helps to find out why the output of custom formats differs from what is expected.
+	Debug func(event string, op *Op)
+
+	// CountFormats counts how many times each format keyword is applied during a render, which tells what the content is
+	// made of. The counts are given in the RenderResult returned by RenderWithResult.
+	CountFormats bool
+
+	// Sanitize, if set, removes the elements and attributes that it does not allow from the HTML written for the ops
+	// (after the HTML is rendered), in case custom formats write unexpected markup. DefaultAllowlist gives an Allowlist
+	// for the built-in formats. The content written after the document (such as footnotes) is not sanitized.
+	Sanitize Allowlist
+
+	blockEnd func() // called whenever a top-level block has been written to the final buffer
+
+	formats map[string]int // the counts of the format keywords applied, with CountFormats
+
+	listItems *int // with ContinueLists, the number of top-level ordered list items in the lists already closed
+}
+
+// readsAttr says if a built-in format reads the attribute although it is not a format of its own (such as the width of an
+// image), so that DataAttrs does not write it as a data attribute.
+func (opts *Options) readsAttr(attr string) bool {
+	switch attr {
+	case "alt", "button", "caption", "cite", "height", "width":
+		return true
+	case "id":
+		return opts.BlockIDs
+	}
+	return false
+}
+
+// containerTag gives the name of the element that the document is written in, if there is one. A Container that is not a
+// valid tag name is written as a <div>.
+func (opts *Options) containerTag() string {
+	if opts.Container == "" && opts.documentDir() == "" {
+		return ""
+	}
+	if !isTagName(opts.Container) {
+		return "div"
+	}
+	return opts.Container
+}
+
+// titleTag gives the name of the element that the title is written in (see FirstLineAsTitle).
+func (opts *Options) titleTag() string {
+	if !isTagName(opts.TitleTag) {
+		return "h1"
+	}
+	return opts.TitleTag
+}
+
+// isTagName says if s is a simple HTML tag name: a lowercase ASCII letter followed by lowercase letters, digits, or "-".
+func isTagName(s string) bool {
+	if s == "" || s[0] < 'a' || s[0] > 'z' {
+		return false
+	}
+	for i := 1; i < len(s); i++ {
+		if c := s[i]; !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// documentDir gives the DocumentDirection if it is a valid direction.
+func (opts *Options) documentDir() string {
+	switch opts.DocumentDirection {
+	case "rtl", "ltr", "auto":
+		return opts.DocumentDirection
+	}
+	return ""
+}
+
+// A FormatOverride changes the Format of a built-in format (see Options.Overrides). At most one of Tag, Class, and Style
+// should be set to change what the format writes and where; the fields that are blank leave the Format as it is. For
+// formats that write their own markup (such as links, lists, and images), only Attrs has an effect, if any.
+type FormatOverride struct {
+	Tag   string            // the name of the tag to write, such as "b"
+	Class string            // the class to write instead of a tag, such as "quote"
+	Style string            // the style declaration to write instead of a tag, such as "font-weight:bold;"
+	Attrs map[string]string // HTML attributes to add to the tag
+}
+
+// apply changes fm as ov says.
+func (ov FormatOverride) apply(fm *Format) {
+	switch {
+	case ov.Tag != "":
+		fm.Place, fm.Val = Tag, ov.Tag
+	case ov.Class != "":
+		fm.Place, fm.Val = Class, ov.Class
+	case ov.Style != "":
+		fm.Place, fm.Val = Style, ov.Style
+	}
+	if len(ov.Attrs) > 0 {
+		attrs := make(map[string]string, len(fm.Attrs)+len(ov.Attrs))
+		for k, v := range fm.Attrs {
+			attrs[k] = v
+		}
+		for k, v := range ov.Attrs {
+			attrs[k] = v
+		}
+		fm.Attrs = attrs
+	}
+}
+
+// An EmptyLineMode says how empty lines are written.
+type EmptyLineMode uint8
+
+// The ways in which empty lines can be written.
+const (
+	EmptyLineParagraph EmptyLineMode = iota // a paragraph with a line break, <p><br></p> (as Quill writes empty lines)
+	EmptyLineBreak                          // only a line break, <br> (for email clients that collapse empty paragraphs)
+	EmptyLineCollapse                       // as with EmptyLineParagraph, but consecutive empty lines are written as one
+	EmptyLineRemove                         // nothing (as is useful for pasted content with runs of empty paragraphs)
+)
+
+// An ImageSizeMode says how the dimensions of images are written.
+type ImageSizeMode uint8
+
+// The ways in which the dimensions of images can be written.
+const (
+	ImageSizeAttrs ImageSizeMode = iota // width and height attributes (in pixels)
+	ImageSizeStyle                      // a style attribute (which can also give lengths such as percentages)
+)
+
+// An UnknownTypePolicy says how ops with an insert type for which there is no format are rendered.
+type UnknownTypePolicy uint8
+
+// The ways in which ops with an unknown insert type can be handled.
+const (
+	UnknownTypeError UnknownTypePolicy = iota // stop rendering and return an error
+	UnknownTypeSkip                           // leave the op out
+	UnknownTypeRaw                            // write the value of the op as text (escaped, with the formats of the op)
+)
+
+// maxNestingDepth is the deepest indent of list items and code block lines if Options.MaxIndentDepth is not set.
+const maxNestingDepth = 5
+
+// nestingDepth gives the indent amount of a list item or a code block line with the "indent" attribute value attr.
+func (opts *Options) nestingDepth(attr string) int {
+	d := indentDepth(attr, opts.MaxIndentDepth)
+	if opts.MaxIndentDepth <= 0 && d > maxNestingDepth {
+		return 0
+	}
+	return d
+}
+
+// escapeText escapes the text s of an op.
+func (opts *Options) escapeText(s string) string {
+	if opts.TextEscaper != nil {
+		return opts.TextEscaper(s)
+	}
+	return html.EscapeString(s)
+}
+
+// stripInvisible removes the characters that render invisibly (except for "\n" and "\t") from s. Zero-width joiners and
+// non-joiners are kept because they affect how emoji and some scripts are displayed.
+func stripInvisible(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r == '\n' || r == '\t' || r == '\u200c' || r == '\u200d':
+			return r
+		case unicode.IsControl(r) || unicode.Is(unicode.Cf, r):
+			return -1
+		}
+		return r
+	}, s)
+}
+
+// replaceShortcodes replaces the emoji shortcodes (names between colons, such as ":smile:") in s with the emoji given by
+// table.
+func replaceShortcodes(s string, table map[string]string) string {
+
+	var b strings.Builder
+	written := 0 // the length of s that has been written to b
+	for i := strings.IndexByte(s, ':'); i != -1; {
+		end := strings.IndexByte(s[i+1:], ':')
+		if end == -1 {
+			break
+		}
+		end += i + 1
+		if emoji, ok := table[s[i+1:end]]; ok && isShortcodeName(s[i+1:end]) {
+			b.WriteString(s[written:i])
+			b.WriteString(emoji)
+			written = end + 1
+			if next := strings.IndexByte(s[written:], ':'); next != -1 {
+				i = written + next
+				continue
+			}
+			break
+		}
+		i = end // The closing colon may open the next shortcode.
+	}
+
+	if written == 0 {
+		return s
+	}
+	b.WriteString(s[written:])
+	return b.String()
+
+}
+
+// isShortcodeName says if name can be the name of an emoji shortcode: letters, digits, "_", "+", and "-".
+func isShortcodeName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' && r != '+' && r != '-' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,1193 @@
+package quill
+
+import (
+	"bytes"
+	"html"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestOptions_StripInvisible(t *testing.T) {
+
+	ops := []byte(`[{"insert":"zero\u200bwidth\ufeff\u0007\n"},{"insert":"tab\tkept"},{"attributes":{"code-block":true},"insert":"\n"}]`)
+
+	cases := map[bool]string{
+		false: "<p>zero\u200bwidth\ufeff\u0007</p><pre>tab\tkept\n</pre>",
+		true:  "<p>zerowidth</p><pre>tab\tkept\n</pre>",
+	}
+
+	for strip, want := range cases {
+		got, err := RenderWithOptions(ops, Options{StripInvisible: strip})
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+		if string(got) != want {
+			t.Errorf("(strip %v) expected %q but got %q", strip, want, got)
+		}
+	}
+
+}
+
+func TestOptions_ChecklistCheckboxes(t *testing.T) {
+
+	ops := []byte(`[{"insert":"done"},{"attributes":{"list":"checked"},"insert":"\n"},
+		{"insert":"todo"},{"attributes":{"list":"unchecked"},"insert":"\n"}]`)
+
+	cases := map[bool]string{
+		false: `<ul data-checked="true"><li>done</li></ul><ul data-checked="false"><li>todo</li></ul>`,
+		true:  `<ul><li><input type="checkbox" checked disabled> done</li><li><input type="checkbox" disabled> todo</li></ul>`,
+	}
+
+	for checkboxes, want := range cases {
+		got, err := RenderWithOptions(ops, Options{ChecklistCheckboxes: checkboxes})
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+		if string(got) != want {
+			t.Errorf("(checkboxes %v) expected %q but got %q", checkboxes, want, got)
+		}
+	}
+
+}
+
+func TestOptions_AriaRoles(t *testing.T) {
+
+	ops := []byte(`[{"insert":"Title"},{"attributes":{"header":2},"insert":"\n"},
+		{"insert":"item"},{"attributes":{"list":"bullet"},"insert":"\n"}]`)
+
+	cases := map[bool]string{
+		false: `<h2>Title</h2><ul><li>item</li></ul>`,
+		true:  `<h2 aria-level="2" role="heading">Title</h2><ul role="list"><li role="listitem">item</li></ul>`,
+	}
+
+	for aria, want := range cases {
+		got, err := RenderWithOptions(ops, Options{AriaRoles: aria})
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+		if string(got) != want {
+			t.Errorf("(aria %v) expected %q but got %q", aria, want, got)
+		}
+	}
+
+}
+
+func TestOptions_AllowedClasses(t *testing.T) {
+
+	ops := []byte(`[{"insert":"intro"},{"attributes":{"class":"lead x\" onclick=\"alert(1)"},"insert":"\n"},{"insert":"text\n"}]`)
+
+	cases := []struct {
+		allowed []string
+		want    string
+	}{
+		{nil, `<p>intro</p><p>text</p>`},
+		{[]string{"lead"}, `<p class="lead">intro</p><p>text</p>`},
+		{[]string{"note"}, `<p>intro</p><p>text</p>`},
+	}
+
+	for _, tc := range cases {
+		got, err := RenderWithOptions(ops, Options{AllowedClasses: tc.allowed})
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+		if string(got) != tc.want {
+			t.Errorf("(allowed %v) expected %q but got %q", tc.allowed, tc.want, got)
+		}
+	}
+
+}
+
+func TestOptions_PresentationalTags(t *testing.T) {
+
+	cases := []struct {
+		attrs                  string
+		semantic, presentation string
+	}{
+		{`{"bold":true}`, "<strong>x</strong>", "<b>x</b>"},
+		{`{"italic":true}`, "<em>x</em>", "<i>x</i>"},
+		{`{"underline":true}`, "<u>x</u>", "<u>x</u>"},
+		{`{"strike":true}`, "<s>x</s>", "<s>x</s>"},
+		{`{"script":"sub"}`, "<sub>x</sub>", "<sub>x</sub>"},
+		{`{"script":"super"}`, "<sup>x</sup>", "<sup>x</sup>"},
+		{`{"bold":true,"italic":true}`, "<em><strong>x</strong></em>", "<b><i>x</i></b>"},
+	}
+
+	for _, tc := range cases {
+		ops := []byte(`[{"attributes":` + tc.attrs + `,"insert":"x"},{"insert":"\n"}]`)
+		for presentational, want := range map[bool]string{false: tc.semantic, true: tc.presentation} {
+			got, err := RenderWithOptions(ops, Options{PresentationalTags: presentational})
+			if err != nil {
+				t.Fatalf("%s", err)
+			}
+			if string(got) != "<p>"+want+"</p>" {
+				t.Errorf("(%s, presentational %v) expected %q but got %q", tc.attrs, presentational, want, got)
+			}
+		}
+	}
+
+}
+
+func TestOptions_Filter(t *testing.T) {
+
+	ops := []byte(`[{"insert":"Published\n"},{"attributes":{"draft":true},"insert":"secret"},{"insert":" visible\n"},
+		{"insert":"Draft "},{"attributes":{"bold":true},"insert":"line"},{"attributes":{"draft":true,"header":2},"insert":"\n"},
+		{"insert":"item"},{"attributes":{"list":"bullet"},"insert":"\n"},
+		{"insert":"draft item"},{"attributes":{"list":"bullet","draft":true},"insert":"\n"},
+		{"insert":"End\n"}]`)
+
+	notDraft := func(o *Op) bool {
+		return !o.HasAttr("draft")
+	}
+
+	got, err := RenderWithOptions(ops, Options{Filter: notDraft})
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if want := "<p>Published</p><p> visible</p><ul><li>item</li></ul><p>End</p>"; string(got) != want {
+		t.Errorf("expected %q but got %q", want, got)
+	}
+
+}
+
+func TestOptions_ColorClasses(t *testing.T) {
+
+	ops := []byte(`[{"attributes":{"color":"red"},"insert":"red"},{"insert":" and "},
+		{"attributes":{"background":"blue"},"insert":"blue"},{"insert":"\n"}]`)
+
+	cases := map[bool]string{
+		false: `<p><span style="color:red;">red</span> and <span style="background-color:blue;">blue</span></p>`,
+		true:  `<p><span class="ql-color-red">red</span> and <span class="ql-bg-blue">blue</span></p>`,
+	}
+
+	for classes, want := range cases {
+		got, err := RenderWithOptions(ops, Options{ColorClasses: classes})
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+		if string(got) != want {
+			t.Errorf("(classes %v) expected %q but got %q", classes, want, got)
+		}
+	}
+
+}
+
+func TestOptions_MaxIndentDepth(t *testing.T) {
+
+	ops := []byte(`[{"insert":"deep"},{"attributes":{"indent":1000000},"insert":"\n"},
+		{"insert":"item"},{"attributes":{"list":"bullet","indent":"50"},"insert":"\n"},
+		{"insert":"quote"},{"attributes":{"blockquote":true,"indent":3},"insert":"\n"}]`)
+
+	cases := map[int]string{
+		0:  `<p class="indent-1000000">deep</p><ul><li class="indent-50">item</li></ul><blockquote class="indent-3">quote</blockquote>`,
+		2:  `<p class="indent-2">deep</p><ul><li class="indent-2">item</li></ul><blockquote class="indent-2">quote</blockquote>`,
+		64: `<p class="indent-64">deep</p><ul><li class="indent-50">item</li></ul><blockquote class="indent-3">quote</blockquote>`,
+	}
+
+	for max, want := range cases {
+		got, err := RenderWithOptions(ops, Options{MaxIndentDepth: max})
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+		if string(got) != want {
+			t.Errorf("(max %d) expected %q but got %q", max, want, got)
+		}
+	}
+
+	// Without a maximum, indents are rendered as they were before there was an option.
+	ops = []byte(`[{"insert":"a"},{"attributes":{"list":"bullet"},"insert":"\n"},{"insert":"b"},{"attributes":{"list":"bullet","indent":1},"insert":"\n"},` +
+		`{"insert":"c"},{"attributes":{"list":"bullet","indent":5},"insert":"\n"},{"insert":"d"},{"attributes":{"list":"bullet","indent":7},"insert":"\n"},` +
+		`{"insert":"e"},{"attributes":{"indent":8},"insert":"\n"}]`)
+	want := `<ul><li>a</li><li class="indent-1">b</li><li class="indent-5">c</li><li class="indent-7">d</li></ul><p class="indent-8">e</p>`
+	got, err := RenderWithOptions(ops, Options{})
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if string(got) != want {
+		t.Errorf("(no max) expected %q but got %q", want, got)
+	}
+
+}
+
+func TestOptions_MentionRenderer(t *testing.T) {
+
+	ops := []byte(`[{"insert":"Hi "},{"insert":{"mention":{"index":"0","denotationChar":"@","id":"42","value":"Fred <3"}}},{"insert":"\n"}]`)
+
+	got, err := Render(ops)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	want := `<p>Hi <span class="mention" data-denotation-char="@" data-id="42" data-value="Fred &lt;3">` +
+		`<span class="ql-mention-denotation-char">@</span>Fred &lt;3</span></p>`
+	if string(got) != want {
+		t.Errorf("expected %q but got %q", want, got)
+	}
+
+	opts := Options{
+		MentionRenderer: func(id, value, denotation string) string {
+			return `<a href="/users/` + url.PathEscape(id) + `">` + html.EscapeString(denotation+value) + `</a>`
+		},
+	}
+
+	got, err = RenderWithOptions(ops, opts)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if want = `<p>Hi <a href="/users/42">@Fred &lt;3</a></p>`; string(got) != want {
+		t.Errorf("expected %q but got %q", want, got)
+	}
+
+}
+
+func TestOptions_TextEscaper(t *testing.T) {
+
+	ops := []byte(`[{"insert":"a <b>"},{"attributes":{"italic":true},"insert":"c"},{"insert":"\n\nd\n"}]`)
+
+	got, err := RenderWithOptions(ops, Options{TextEscaper: strings.ToUpper})
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if want := `<p>A <B><em>C</em></p><p><br></p><p>D</p>`; string(got) != want {
+		t.Errorf("expected %q but got %q", want, got)
+	}
+
+}
+
+func TestOptions_AutoLink(t *testing.T) {
+
+	cases := map[string]struct {
+		ops, want string
+	}{
+		"bare URL": {
+			ops:  `[{"insert":"See https://example.com/a?b=1&c=2. Or http:// alone.\n"}]`,
+			want: `<p>See <a href="https://example.com/a?b=1&amp;c=2" target="_blank">https://example.com/a?b=1&amp;c=2</a>. Or http:// alone.</p>`,
+		},
+		"formatted URL": {
+			ops:  `[{"attributes":{"bold":true},"insert":"(http://x.io)"},{"insert":"\n"}]`,
+			want: `<p><strong>(<a href="http://x.io" target="_blank">http://x.io</a>)</strong></p>`,
+		},
+		"inside link": {
+			ops:  `[{"attributes":{"link":"https://example.com"},"insert":"https://example.com"},{"insert":"\n"}]`,
+			want: `<p><a href="https://example.com" target="_blank">https://example.com</a></p>`,
+		},
+	}
+
+	for name, tc := range cases {
+		got, err := RenderWithOptions([]byte(tc.ops), Options{AutoLink: true})
+		if err != nil {
+			t.Fatalf("(%s) %s", name, err)
+		}
+		if string(got) != tc.want {
+			t.Errorf("(%s) expected %q but got %q", name, tc.want, got)
+		}
+	}
+
+}
+
+func TestOptions_LazyImages(t *testing.T) {
+
+	ops := []byte(`[{"insert":{"image":"/a.png"}},{"insert":"\n"}]`)
+
+	got, err := RenderWithOptions(ops, Options{LazyImages: true})
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if want := `<p><img src="/a.png" loading="lazy" decoding="async"></p>`; string(got) != want {
+		t.Errorf("expected %q but got %q", want, got)
+	}
+
+	got, err = Render(ops)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if want := `<p><img src="/a.png"></p>`; string(got) != want {
+		t.Errorf("expected %q but got %q", want, got)
+	}
+
+}
+
+func TestOptions_Footnotes(t *testing.T) {
+
+	ops := []byte(`[{"insert":"Go"},{"attributes":{"footnote":"A language."},"insert":" is"},{"insert":" fast"},` +
+		`{"attributes":{"footnote":"Citation <needed>"},"insert":"."},{"insert":"\n"}]`)
+
+	var ends int
+	opts := Options{
+		Footnotes:   new(FootnoteCollector),
+		DocumentEnd: func(dst *bytes.Buffer) { ends++ },
+	}
+
+	want := `<p>Go is<sup class="footnote-ref"><a href="#fn-1" id="fnref-1">1</a></sup> fast.` +
+		`<sup class="footnote-ref"><a href="#fn-2" id="fnref-2">2</a></sup></p>` +
+		`<ol class="footnotes"><li id="fn-1">A language. <a href="#fnref-1">&#8617;</a></li>` +
+		`<li id="fn-2">Citation &lt;needed&gt; <a href="#fnref-2">&#8617;</a></li></ol>`
+
+	// The collector can be reused.
+	for i := 0; i < 2; i++ {
+		got, err := RenderWithOptions(ops, opts)
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+		if string(got) != want {
+			t.Errorf("expected %q but got %q", want, got)
+		}
+	}
+
+	if ends != 2 {
+		t.Errorf("DocumentEnd called %d times", ends)
+	}
+
+}
+
+func TestOptions_StyleNonce(t *testing.T) {
+
+	ops := []byte(`[{"insert":"a "},{"attributes":{"color":"#e60000"},"insert":"red"},{"insert":" word"},` +
+		`{"attributes":{"color":"#e60000","size":"20px"},"insert":"!"},{"attributes":{"color":"red}</style>"},"insert":"?"},` +
+		`{"insert":"\n"}]`)
+
+	got, err := RenderWithOptions(ops, Options{StyleNonce: "r4nd"})
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	// The color that could break out of the style sheet is dropped.
+	want := `<p>a <span class="ql-s-iiob49">red</span> word<span class="ql-s-ga8w6v"><span class="ql-s-iiob49">!</span></span>?</p>` +
+		`<style nonce="r4nd">.ql-s-ga8w6v{font-size:20px;}.ql-s-iiob49{color:#e60000;}</style>`
+	if string(got) != want {
+		t.Errorf("expected %q but got %q", want, got)
+	}
+
+	// Two declarations with the same hash are given different classes.
+	ops = []byte(`[{"attributes":{"color":"#0089db"},"insert":"a"},{"attributes":{"color":"#047828"},"insert":"b"},` +
+		`{"attributes":{"color":"#0089db"},"insert":"c"},{"insert":"\n"}]`)
+	got, err = RenderWithOptions(ops, Options{StyleNonce: "r4nd"})
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if n := strings.Count(string(got), "{color:"); n != 2 {
+		t.Errorf("expected 2 style rules but got %d in %q", n, got)
+	}
+	if !strings.Contains(string(got), `-2{color:#047828;}`) {
+		t.Errorf("the second declaration has no numbered class in %q", got)
+	}
+
+}
+
+func TestOptions_ImageCaptions(t *testing.T) {
+
+	ops := []byte(`[{"attributes":{"caption":"Sunset <2020>"},"insert":{"image":"/s.jpg"}},{"insert":{"image":"/t.jpg"}},{"insert":"\n"}]`)
+
+	got, err := RenderWithOptions(ops, Options{ImageCaptions: true})
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	want := `<figure><img src="/s.jpg"><figcaption>Sunset &lt;2020&gt;</figcaption></figure><p><img src="/t.jpg"></p>`
+	if string(got) != want {
+		t.Errorf("expected %q but got %q", want, got)
+	}
+
+	// The paragraph around a captioned image is closed before the figure and opened again after it.
+	cases := []struct {
+		ops, want string
+	}{
+		{
+			ops: `[{"insert":"a "},{"attributes":{"caption":"Cap","link":"/big.jpg"},"insert":{"image":"/s.jpg"}},{"insert":" b\n"}]`,
+			want: `<p>a </p><figure><a href="/big.jpg" target="_blank"><img src="/s.jpg"></a><figcaption>Cap</figcaption></figure>` +
+				`<p> b</p>`,
+		},
+		{
+			ops: `[{"attributes":{"bold":true},"insert":"a"},{"attributes":{"bold":true,"caption":"Cap"},"insert":{"image":"/s.jpg"}},` +
+				`{"attributes":{"bold":true},"insert":"b"},{"attributes":{"align":"center","id":"x"},"insert":"\n"}]`,
+			want: `<p class="align-center" id="x"><strong>a</strong></p><figure><strong><img src="/s.jpg"></strong>` +
+				`<figcaption>Cap</figcaption></figure><p class="align-center"><strong>b</strong></p>`,
+		},
+		{
+			ops: `[{"insert":"a\t"},{"attributes":{"caption":"Cap"},"insert":{"image":"/s.jpg"}},{"insert":"b"},` +
+				`{"attributes":{"header":2},"insert":"\n"}]`,
+			want: `<h2>a&nbsp;&nbsp;</h2><figure><img src="/s.jpg"><figcaption>Cap</figcaption></figure><h2>b</h2>`,
+		},
+		{
+			// A list item can hold a figure.
+			ops:  `[{"insert":"a"},{"attributes":{"caption":"Cap"},"insert":{"image":"/s.jpg"}},{"attributes":{"list":"bullet"},"insert":"\n"}]`,
+			want: `<ul><li>a<figure><img src="/s.jpg"><figcaption>Cap</figcaption></figure></li></ul>`,
+		},
+	}
+	for _, tc := range cases {
+		got, err := RenderWithOptions([]byte(tc.ops), Options{ImageCaptions: true, BlockIDs: true, TabWidth: 2})
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+		if string(got) != tc.want {
+			t.Errorf("expected %q but got %q", tc.want, got)
+		}
+	}
+
+	got, err = Render(ops)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if want = `<p><img src="/s.jpg"><img src="/t.jpg"></p>`; string(got) != want {
+		t.Errorf("expected %q but got %q", want, got)
+	}
+
+}
+
+func TestOptions_Debug(t *testing.T) {
+
+	ops := []byte(`[{"insert":"Hi "},{"attributes":{"bold":true},"insert":"there"},{"attributes":{"header":1},"insert":"\n"}]`)
+
+	var events []string
+	opts := Options{
+		Debug: func(event string, op *Op) {
+			events = append(events, event)
+		},
+	}
+
+	if _, err := RenderWithOptions(ops, opts); err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	want := []string{"format text", "format text", "format bold", "format text", "format header", "open h1", "close h1"}
+	if strings.Join(events, ",") != strings.Join(want, ",") {
+		t.Errorf("expected events %q but got %q", want, events)
+	}
+
+}
+
+func TestOptions_FormulaMathML(t *testing.T) {
+
+	ops := []byte(`[{"insert":{"formula":"e=mc^2"}},{"insert":"\n"}]`)
+
+	got, err := RenderWithOptions(ops, Options{FormulaMathML: true})
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	want := `<p><math><semantics><mrow><mi>e</mi><mo>=</mo><mi>m</mi><msup><mi>c</mi><mn>2</mn></msup></mrow>` +
+		`<annotation encoding="application/x-tex">e=mc^2</annotation></semantics></math></p>`
+	if string(got) != want {
+		t.Errorf("expected %q but got %q", want, got)
+	}
+
+}
+
+func TestOptions_PreserveLeadingSpaces(t *testing.T) {
+
+	ops := []byte(`[{"insert":"  "},{"attributes":{"bold":true},"insert":" a  b"},{"insert":"\n  code"},` +
+		`{"attributes":{"code-block":true},"insert":"\n"},{"insert":"c\n"}]`)
+
+	got, err := RenderWithOptions(ops, Options{PreserveLeadingSpaces: true})
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	want := `<p>&nbsp;&nbsp;<strong>&nbsp;a  b</strong></p><pre>  code` + "\n" + `</pre><p>c</p>`
+	if string(got) != want {
+		t.Errorf("expected %q but got %q", want, got)
+	}
+
+}
+
+func TestOptions_SoftBreaks(t *testing.T) {
+
+	ops := []byte(`[{"insert":"one\n"},{"attributes":{"bold":true},"insert":"two"},{"insert":"\n\nthree\n\n\nfour\nTitle"},` +
+		`{"attributes":{"header":2},"insert":"\n"},{"insert":"five\nsix"}]`)
+
+	cases := []struct {
+		soft bool
+		want string
+	}{
+		{false, `<p>one</p><p><strong>two</strong></p><p><br></p><p>three</p><p><br></p><p><br></p><p>four</p><h2>Title</h2>` +
+			`<p>five</p><p>six</p>`},
+		{true, `<p>one<br><strong>two</strong></p><p>three</p><p><br></p><p>four</p><h2>Title</h2><p>five<br>six</p>`},
+	}
+
+	for _, tc := range cases {
+		got, err := RenderWithOptions(ops, Options{SoftBreaks: tc.soft})
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+		if string(got) != tc.want {
+			t.Errorf("(soft %v) expected %q but got %q", tc.soft, tc.want, got)
+		}
+	}
+
+}
+
+func TestOptions_KeyboardAndMark(t *testing.T) {
+
+	ops := []byte(`[{"insert":"Press "},{"attributes":{"keyboard":true},"insert":"Ctrl"},{"insert":" to "},` +
+		`{"attributes":{"mark":true},"insert":"copy"},{"insert":"\n"}]`)
+
+	got, err := RenderWithOptions(ops, Options{KeyboardAndMark: true})
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if want := `<p>Press <kbd>Ctrl</kbd> to <mark>copy</mark></p>`; string(got) != want {
+		t.Errorf("expected %q but got %q", want, got)
+	}
+
+	got, err = Render(ops)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if want := `<p>Press Ctrl to copy</p>`; string(got) != want {
+		t.Errorf("expected %q but got %q", want, got)
+	}
+
+}
+
+func TestOptions_EmptyDocument(t *testing.T) {
+
+	for _, empty := range []string{"", "<p><br></p>"} {
+		got, err := RenderWithOptions([]byte(`[]`), Options{EmptyDocument: empty})
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+		if string(got) != empty {
+			t.Errorf("expected %q but got %q", empty, got)
+		}
+	}
+
+}
+
+func TestOptions_ListAttrs(t *testing.T) {
+
+	ops := []byte(`[{"insert":"a"},{"attributes":{"list":"bullet"},"insert":"\n"},{"insert":"b"},{"attributes":{"list":"bullet"},"insert":"\n"},` +
+		`{"insert":"c"},{"attributes":{"list":"ordered"},"insert":"\n"}]`)
+
+	got, err := RenderWithOptions(ops, Options{ListAttrs: map[string]string{"class": "prose-list"}})
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	want := `<ul class="prose-list"><li>a</li><li>b</li></ul><ol class="prose-list"><li>c</li></ol>`
+	if string(got) != want {
+		t.Errorf("expected %q but got %q", want, got)
+	}
+
+}
+
+func TestOptions_Dividers(t *testing.T) {
+
+	ops := []byte(`[{"insert":"above\n---\nbetween\n***\n"},{"attributes":{"bold":true},"insert":"---"},{"insert":"\n-- -\n---"},` +
+		`{"attributes":{"align":"center"},"insert":"\n"},{"insert":"***"},{"attributes":{"indent":1},"insert":"\n"}]`)
+
+	got, err := RenderWithOptions(ops, Options{Dividers: true})
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	want := `<p>above</p><hr><p>between</p><hr><p><strong>---</strong></p><p>-- -</p><p class="align-center">---</p>` +
+		`<p class="indent-1">***</p>`
+	if string(got) != want {
+		t.Errorf("expected %q but got %q", want, got)
+	}
+
+}
+
+func TestOptions_DataAttrs(t *testing.T) {
+
+	ops := []byte(`[{"insert":"a"},{"attributes":{"foo":"1","bold":true},"insert":"b"},{"attributes":{"foo":"1","bar":"x"},"insert":"c"},` +
+		`{"attributes":{"x\" onclick=\"y":"z","indent":0},"insert":"d"},{"insert":"\n"}]`)
+
+	got, err := RenderWithOptions(ops, Options{DataAttrs: true})
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	want := `<p>a<span data-foo="1"><strong>b</strong><span data-bar="x">c</span></span>d</p>`
+	if string(got) != want {
+		t.Errorf("expected %q but got %q", want, got)
+	}
+
+	// The attributes that the built-in formats read are not written as data attributes.
+	ops = []byte(`[{"attributes":{"width":"300","alt":"A","foo":"1"},"insert":{"image":"/a.png"}},` +
+		`{"attributes":{"link":"/b","button":true},"insert":"b"},{"insert":"\n"}]`)
+	got, err = RenderWithOptions(ops, Options{DataAttrs: true})
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	want = `<p><span data-foo="1"><img src="/a.png" alt="A" width="300"></span><a class="btn" href="/b" target="_blank">b</a></p>`
+	if string(got) != want {
+		t.Errorf("expected %q but got %q", want, got)
+	}
+
+}
+
+func TestOptions_BaseURL(t *testing.T) {
+
+	ops := []byte(`[{"insert":{"image":"img/a.png"}},{"insert":{"image":"https://cdn.example.org/b.png"}},` +
+		`{"attributes":{"link":"../about"},"insert":"about"},{"attributes":{"link":"#top"},"insert":"top"},{"insert":"\n"}]`)
+
+	got, err := RenderWithOptions(ops, Options{BaseURL: "https://example.com/docs/guide/"})
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	want := `<p><img src="https://example.com/docs/guide/img/a.png"><img src="https://cdn.example.org/b.png">` +
+		`<a href="https://example.com/docs/about" target="_blank">about</a><a href="#top" target="_blank">top</a></p>`
+	if string(got) != want {
+		t.Errorf("expected %q but got %q", want, got)
+	}
+
+	if got := resolveURL("https://example.com/", "%zz"); got != "%zz" {
+		t.Errorf("invalid URL resolved to %q", got)
+	}
+
+}
+
+func TestOptions_ContinueLists(t *testing.T) {
+
+	ops := []byte(`[{"insert":"one"},{"attributes":{"list":"ordered"},"insert":"\n"},{"insert":"two"},` +
+		`{"attributes":{"list":"ordered"},"insert":"\n"},{"insert":"three"},{"attributes":{"list":"ordered"},"insert":"\n"},` +
+		`{"insert":"Interruption\nfour"},{"attributes":{"list":"ordered"},"insert":"\n"},{"insert":"sub"},` +
+		`{"attributes":{"indent":1,"list":"ordered"},"insert":"\n"},{"insert":"five"},{"attributes":{"list":"ordered"},"insert":"\n"}]`)
+
+	want := `<ol><li>one</li><li>two</li><li>three</li></ol><p>Interruption</p>` +
+		`<ol start="4"><li>four</li><li class="indent-1" value="1">sub</li><li value="5">five</li></ol>`
+	got, err := RenderWithOptions(ops, Options{ContinueLists: true})
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if string(got) != want {
+		t.Errorf("expected %q but got %q", want, got)
+	}
+
+	// Without the option, the numbering starts over.
+	want = `<ol><li>one</li><li>two</li><li>three</li></ol><p>Interruption</p>` +
+		`<ol><li>four</li><li class="indent-1" value="1">sub</li><li>five</li></ol>`
+	got, err = Render(ops)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if string(got) != want {
+		t.Errorf("expected %q but got %q", want, got)
+	}
+
+}
+
+func TestOptions_CountFormats(t *testing.T) {
+
+	ops := []byte(`[{"insert":"Title"},{"attributes":{"header":1},"insert":"\n"},{"attributes":{"bold":true},"insert":"bold"},` +
+		`{"insert":" and "},{"attributes":{"link":"https://example.com"},"insert":"a link"},{"insert":"\n"}]`)
+
+	res, err := RenderWithResult(ops, Options{CountFormats: true})
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	want := map[string]int{"text": 6, "header": 1, "bold": 1, "link": 1}
+	if len(res.Formats) != len(want) {
+		t.Errorf("expected formats %v but got %v", want, res.Formats)
+	}
+	for k, n := range want {
+		if res.Formats[k] != n {
+			t.Errorf("expected %q counted %d times but got %d", k, n, res.Formats[k])
+		}
+	}
+	if html, _ := Render(ops); string(res.HTML) != string(html) {
+		t.Errorf("expected HTML %q but got %q", html, res.HTML)
+	}
+
+	if res, _ = RenderWithResult(ops, Options{}); res.Formats != nil {
+		t.Errorf("formats counted without CountFormats: %v", res.Formats)
+	}
+
+}
+
+func TestOptions_TrimTrailingSpace(t *testing.T) {
+
+	ops := []byte(`[{"insert":"Some text  "},{"attributes":{"bold":true},"insert":"bold\t "},{"insert":" \n"},` +
+		`{"insert":"code  "},{"attributes":{"code-block":true},"insert":"\n"},{"insert":"a "},{"insert":{"image":"x.png"}},` +
+		`{"insert":" \n"}]`)
+
+	cases := map[bool]string{
+		false: "<p>Some text  <strong>bold\t </strong> </p><pre>code  \n</pre><p>a <img src=\"x.png\"> </p>",
+		true:  "<p>Some text  <strong>bold</strong></p><pre>code  \n</pre><p>a <img src=\"x.png\"></p>",
+	}
+	for trim, want := range cases {
+		got, err := RenderWithOptions(ops, Options{TrimTrailingSpace: trim})
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+		if string(got) != want {
+			t.Errorf("(trim %v) expected %q but got %q", trim, want, got)
+		}
+	}
+
+	// Lines joined with SoftBreaks are trimmed before each line break.
+	got, err := RenderWithOptions([]byte(`[{"insert":"one  \ntwo \n"}]`), Options{TrimTrailingSpace: true, SoftBreaks: true})
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if want := "<p>one<br>two</p>"; string(got) != want {
+		t.Errorf("expected %q but got %q", want, got)
+	}
+
+}
+
+func TestOptions_LooseLists(t *testing.T) {
+
+	ops := []byte(`[{"insert":"one"},{"attributes":{"list":"bullet"},"insert":"\n"},{"attributes":{"italic":true},"insert":"two"},` +
+		`{"attributes":{"list":"bullet","blockquote":true},"insert":"\n"},{"insert":"after\n"}]`)
+
+	cases := map[bool]string{
+		false: `<ul><li>one</li><li><blockquote><em>two</em></blockquote></li></ul><p>after</p>`,
+		true:  `<ul><li><p>one</p></li><li><blockquote><p><em>two</em></p></blockquote></li></ul><p>after</p>`,
+	}
+	for loose, want := range cases {
+		got, err := RenderWithOptions(ops, Options{LooseLists: loose})
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+		if string(got) != want {
+			t.Errorf("(loose %v) expected %q but got %q", loose, want, got)
+		}
+	}
+
+}
+
+func TestOptions_FootnoteReference(t *testing.T) {
+
+	ops := []byte(`[{"insert":"Go"},{"attributes":{"footnote":"A language."},"insert":"pher"},{"insert":" digs.\n"}]`)
+
+	got, err := RenderWithOptions(ops, Options{Footnotes: new(FootnoteCollector)})
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	want := `<p>Gopher<sup class="footnote-ref"><a href="#fn-1" id="fnref-1">1</a></sup> digs.</p>` +
+		`<ol class="footnotes"><li id="fn-1">A language. <a href="#fnref-1">&#8617;</a></li></ol>`
+	if string(got) != want {
+		t.Errorf("expected %q but got %q", want, got)
+	}
+
+}
+
+func TestFootnoteFormat_Wrap(t *testing.T) {
+
+	fc := new(FootnoteCollector)
+	ff := &footnoteFormat{fc: fc, body: "A note."}
+	if !ff.Open(nil, NewTextOp("a", map[string]string{"footnote": "A note."})) {
+		t.Fatalf("the reference was not opened")
+	}
+
+	// Wrap can be called any number of times without adding the footnote again.
+	_, first := ff.Wrap()
+	_, second := ff.Wrap()
+	if first != second || len(fc.notes) != 1 {
+		t.Errorf("got wraps %q and %q and %d footnotes", first, second, len(fc.notes))
+	}
+
+}
+
+func TestOptions_FootnoteMention(t *testing.T) {
+
+	ops := []byte(`[{"insert":"Ask "},{"attributes":{"note":"The maintainer."},` +
+		`"insert":{"mention":{"id":"7","value":"ann","denotationChar":"@"}}},{"insert":"\n"}]`)
+
+	got, err := RenderWithOptions(ops, Options{Footnotes: &FootnoteCollector{Attr: "note"}})
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	want := `<p>Ask <span class="mention" data-denotation-char="@" data-id="7" data-value="ann">` +
+		`<span class="ql-mention-denotation-char">@</span>ann</span>` +
+		`<sup class="footnote-ref"><a href="#fn-1" id="fnref-1">1</a></sup></p>` +
+		`<ol class="footnotes"><li id="fn-1">The maintainer. <a href="#fnref-1">&#8617;</a></li></ol>`
+	if string(got) != want {
+		t.Errorf("expected %q but got %q", want, got)
+	}
+
+}
+
+func TestOptions_UnknownTypePolicy(t *testing.T) {
+
+	ops := []byte(`[{"insert":"a "},{"attributes":{"bold":true},"insert":{"widget":"<w>"}},{"insert":" b\n"}]`)
+
+	cases := []struct {
+		policy UnknownTypePolicy
+		want   string
+	}{
+		{UnknownTypeSkip, `<p>a  b</p>`},
+		{UnknownTypeRaw, `<p>a <strong>&lt;w&gt;</strong> b</p>`},
+	}
+	for _, tc := range cases {
+		got, err := RenderWithOptions(ops, Options{UnknownTypePolicy: tc.policy})
+		if err != nil {
+			t.Errorf("(policy %d) %s", tc.policy, err)
+		}
+		if string(got) != tc.want {
+			t.Errorf("(policy %d) expected %q but got %q", tc.policy, tc.want, got)
+		}
+	}
+
+	if _, err := RenderWithOptions(ops, Options{UnknownTypePolicy: UnknownTypeError}); err == nil {
+		t.Errorf("no error for an unknown type")
+	}
+
+}
+
+func TestOptions_TabWidth(t *testing.T) {
+
+	ops := []byte(`[{"insert":"\tIndented"},{"attributes":{"bold":true},"insert":"\tbold"},{"insert":"\n\tcode"},` +
+		`{"attributes":{"code-block":true},"insert":"\n"},{"insert":"end\t\n"}]`)
+
+	cases := []struct {
+		opts Options
+		want string
+	}{
+		{Options{}, "<p>\tIndented<strong>\tbold</strong></p><pre>\tcode\n</pre><p>end\t</p>"},
+		{Options{TabWidth: 2}, "<p>&nbsp;&nbsp;Indented<strong>&nbsp;&nbsp;bold</strong></p><pre>\tcode\n</pre><p>end&nbsp;&nbsp;</p>"},
+		{Options{TabWidth: 2, TrimTrailingSpace: true}, "<p>&nbsp;&nbsp;Indented<strong>&nbsp;&nbsp;bold</strong></p><pre>\tcode\n</pre><p>end</p>"},
+	}
+	for i, tc := range cases {
+		got, err := RenderWithOptions(ops, tc.opts)
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+		if string(got) != tc.want {
+			t.Errorf("(case %d) expected %q but got %q", i, tc.want, got)
+		}
+	}
+
+}
+
+func TestOptions_EmptyLineMode(t *testing.T) {
+
+	// Three consecutive empty lines are followed by a text line and another empty line.
+	ops := []byte(`[{"insert":"one\n\n\n"},{"attributes":{"align":"center"},"insert":"\n"},{"insert":"two\n\n"}]`)
+
+	cases := map[EmptyLineMode]string{
+		EmptyLineParagraph: `<p>one</p><p><br></p><p><br></p><p class="align-center"><br></p><p>two</p><p><br></p>`,
+		EmptyLineBreak:     `<p>one</p><br><br><br><p>two</p><br>`,
+		EmptyLineCollapse:  `<p>one</p><p><br></p><p>two</p><p><br></p>`,
+		EmptyLineRemove:    `<p>one</p><p>two</p>`,
+	}
+	for mode, want := range cases {
+		got, err := RenderWithOptions(ops, Options{EmptyLineMode: mode})
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+		if string(got) != want {
+			t.Errorf("(mode %d) expected %q but got %q", mode, want, got)
+		}
+	}
+
+}
+
+func TestOptions_LinkRel(t *testing.T) {
+
+	ops := []byte(`[{"attributes":{"link":"https://example.com"},"insert":"site"},{"insert":" and https://example.org\n"}]`)
+
+	got, err := RenderWithOptions(ops, Options{LinkRel: "ugc nofollow", AutoLink: true})
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	want := `<p><a href="https://example.com" target="_blank" rel="ugc nofollow">site</a> and ` +
+		`<a href="https://example.org" target="_blank" rel="ugc nofollow">https://example.org</a></p>`
+	if string(got) != want {
+		t.Errorf("expected %q but got %q", want, got)
+	}
+
+}
+
+func TestOptions_DataImagePlaceholder(t *testing.T) {
+
+	src := "data:image/png;base64," + strings.Repeat("iVBORw0KGgo+/=", 5000)
+	ops := []byte(`[{"insert":"a"},{"insert":{"image":"` + src + `"}},{"insert":{"image":"/b.png"}},{"insert":"\n"}]`)
+
+	// By default, a data URL is kept exactly (even with a BaseURL or when the output is sanitized).
+	got, err := RenderWithOptions(ops, Options{BaseURL: "https://example.com/", Sanitize: DefaultAllowlist()})
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	want := `<p>a<img src="` + src + `"><img src="https://example.com/b.png"></p>`
+	if string(got) != want {
+		t.Errorf("data URL image not kept: got %q", got)
+	}
+
+	got, err = RenderWithOptions(ops, Options{DataImagePlaceholder: `<span class="image-removed">[image]</span>`})
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	want = `<p>a<span class="image-removed">[image]</span><img src="/b.png"></p>`
+	if string(got) != want {
+		t.Errorf("expected %q but got %q", want, got)
+	}
+
+}
+
+func TestOptions_ImageSizeMode(t *testing.T) {
+
+	ops := []byte(`[{"attributes":{"width":"300","height":"200"},"insert":{"image":"/a.png"}},` +
+		`{"attributes":{"width":"50%","height":"auto;color:red"},"insert":{"image":"/b.png"}},{"insert":"\n"}]`)
+
+	cases := map[ImageSizeMode]string{
+		ImageSizeAttrs: `<p><img src="/a.png" width="300" height="200"><img src="/b.png"></p>`,
+		ImageSizeStyle: `<p><img src="/a.png" style="width:300px;height:200px;"><img src="/b.png" style="width:50%;"></p>`,
+	}
+	for mode, want := range cases {
+		got, err := RenderWithOptions(ops, Options{ImageSizeMode: mode})
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+		if string(got) != want {
+			t.Errorf("(mode %d) expected %q but got %q", mode, want, got)
+		}
+	}
+
+}
+
+func TestOptions_Details(t *testing.T) {
+
+	ops := []byte(`[{"insert":"Spoiler"},{"attributes":{"details":true},"insert":"\n"},{"insert":"The "},` +
+		`{"attributes":{"bold":true},"insert":"butler"},{"insert":" did it."},{"attributes":{"details":true},"insert":"\n"},` +
+		`{"insert":"After\n"}]`)
+
+	cases := map[bool]string{
+		false: `<p>Spoiler</p><p>The <strong>butler</strong> did it.</p><p>After</p>`,
+		true:  `<details><summary>Spoiler</summary><p>The <strong>butler</strong> did it.</p></details><p>After</p>`,
+	}
+	for details, want := range cases {
+		got, err := RenderWithOptions(ops, Options{Details: details})
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+		if string(got) != want {
+			t.Errorf("(details %v) expected %q but got %q", details, want, got)
+		}
+	}
+
+}
+
+func TestOptions_EmojiShortcodes(t *testing.T) {
+
+	ops := []byte(`[{"insert":"Hi :smile: at 10:30:00 :unknown: :+1::smile:"},{"insert":"\n:smile:"},` +
+		`{"attributes":{"code-block":true},"insert":"\n"}]`)
+
+	got, err := RenderWithOptions(ops, Options{EmojiShortcodes: map[string]string{"smile": "\U0001F604", "+1": "\U0001F44D"}})
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	want := "<p>Hi \U0001F604 at 10:30:00 :unknown: \U0001F44D\U0001F604</p><pre>:smile:\n</pre>"
+	if string(got) != want {
+		t.Errorf("expected %q but got %q", want, got)
+	}
+
+}
+
+func TestOptions_Overrides(t *testing.T) {
+
+	ops := []byte(`[{"attributes":{"bold":true},"insert":"Bold"},{"insert":" "},{"attributes":{"italic":true},"insert":"it"},` +
+		`{"insert":"\nQuote"},{"attributes":{"blockquote":true},"insert":"\n"},{"attributes":{"link":"/a"},"insert":"link"},{"insert":"\n"}]`)
+
+	opts := Options{Overrides: map[string]FormatOverride{
+		"bold":       {Tag: "b"},
+		"italic":     {Tag: "i", Attrs: map[string]string{"lang": "fr"}},
+		"blockquote": {Class: "quote"},
+		"link":       {Attrs: map[string]string{"rel": "nofollow"}},
+	}}
+	got, err := RenderWithOptions(ops, opts)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	want := `<p><b>Bold</b> <i lang="fr">it</i></p><p class="quote">Quote</p>` +
+		`<p><a href="/a" target="_blank" rel="nofollow">link</a></p>`
+	if string(got) != want {
+		t.Errorf("expected %q but got %q", want, got)
+	}
+
+}
+
+func TestOptions_CodeLineNumbers(t *testing.T) {
+
+	ops := []byte(`[{"insert":"if x {"},{"attributes":{"code-block":"go"},"insert":"\n"},{"insert":"return a < b"},` +
+		`{"attributes":{"code-block":"go","indent":1},"insert":"\n"},{"insert":"}"},{"attributes":{"code-block":"go"},"insert":"\n"}]`)
+
+	cases := []struct {
+		numbered bool
+		want     string
+	}{
+		{false, "<pre><code class=\"language-go\">if x {\n\treturn a &lt; b\n}\n</code></pre>"},
+		{true, "<pre><code class=\"language-go\"><span class=\"line\">if x {</span>\n<span class=\"line\">\treturn a &lt; b</span>\n" +
+			"<span class=\"line\">}</span>\n</code></pre>"},
+	}
+	for _, tc := range cases {
+		got, err := RenderWithOptions(ops, Options{CodeLineNumbers: tc.numbered})
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+		if string(got) != tc.want {
+			t.Errorf("(numbered %v) expected %q but got %q", tc.numbered, tc.want, got)
+		}
+	}
+
+}
+
+func TestOptions_DocumentDirection(t *testing.T) {
+
+	ops := []byte(`[{"insert":"שלום"},{"attributes":{"header":1},"insert":"\n"},{"insert":"עולם\n"}]`)
+
+	cases := []struct {
+		opts Options
+		want string
+	}{
+		{Options{DocumentDirection: "rtl"}, `<div dir="rtl"><h1>שלום</h1><p>עולם</p></div>`},
+		{Options{DocumentDirection: "rtl", Container: "article"}, `<article dir="rtl"><h1>שלום</h1><p>עולם</p></article>`},
+		{Options{Container: "article"}, `<article><h1>שלום</h1><p>עולם</p></article>`},
+		{Options{DocumentDirection: `rtl"`}, `<h1>שלום</h1><p>עולם</p>`},
+		{Options{Container: "div onclick=x"}, `<div><h1>שלום</h1><p>עולם</p></div>`},
+	}
+	for i, tc := range cases {
+		got, err := RenderWithOptions(ops, tc.opts)
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+		if string(got) != tc.want {
+			t.Errorf("(case %d) expected %q but got %q", i, tc.want, got)
+		}
+		var buf bytes.Buffer
+		if err = RenderTo(&buf, ops, tc.opts); err != nil {
+			t.Fatalf("%s", err)
+		}
+		if buf.String() != tc.want {
+			t.Errorf("(case %d, stream) expected %q but got %q", i, tc.want, buf.String())
+		}
+	}
+
+}
+
+func TestOptions_HeadingOffset(t *testing.T) {
+
+	ops := []byte(`[{"insert":"Title"},{"attributes":{"header":1},"insert":"\n"},{"insert":"Part"},{"attributes":{"header":2},"insert":"\n"},` +
+		`{"insert":"Detail"},{"attributes":{"header":6},"insert":"\n"}]`)
+
+	cases := []struct {
+		opts Options
+		want string
+	}{
+		{Options{HeadingOffset: 1}, `<h2>Title</h2><h3>Part</h3><h6>Detail</h6>`},
+		{Options{HeadingOffset: -1}, `<h1>Title</h1><h1>Part</h1><h5>Detail</h5>`},
+		{Options{HeadingOffset: 1, AriaRoles: true}, `<h2 aria-level="2" role="heading">Title</h2><h3 aria-level="3" role="heading">Part</h3>` +
+			`<h6 aria-level="6" role="heading">Detail</h6>`},
+	}
+	for i, tc := range cases {
+		got, err := RenderWithOptions(ops, tc.opts)
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+		if string(got) != tc.want {
+			t.Errorf("(case %d) expected %q but got %q", i, tc.want, got)
+		}
+	}
+
+}
+
+func TestOptions_Abbreviations(t *testing.T) {
+
+	ops := []byte(`[{"insert":"The "},{"attributes":{"abbr":"World Health Organization"},"insert":"WHO"},{"insert":" and "},` +
+		`{"attributes":{"abbr":"Hypertext \"Markup\" Language","bold":true},"insert":"HTML"},{"insert":"\n"}]`)
+
+	got, err := RenderWithOptions(ops, Options{Abbreviations: true})
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	want := `<p>The <abbr title="World Health Organization">WHO</abbr> and ` +
+		`<abbr title="Hypertext &#34;Markup&#34; Language"><strong>HTML</strong></abbr></p>`
+	if string(got) != want {
+		t.Errorf("expected %q but got %q", want, got)
+	}
+
+	// Without the option, the attribute is ignored.
+	got, err = Render(ops)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if want = `<p>The WHO and <strong>HTML</strong></p>`; string(got) != want {
+		t.Errorf("expected %q but got %q", want, got)
+	}
+
+}
+
+func TestOptions_FirstLineAsTitle(t *testing.T) {
+
+	ops := []byte(`[{"insert":"My "},{"attributes":{"italic":true},"insert":"first"},{"insert":" post"},` +
+		`{"attributes":{"align":"center","list":"bullet"},"insert":"\n"},{"insert":"Body text.\nMore"},{"attributes":{"header":1},"insert":"\n"}]`)
+
+	cases := []struct {
+		opts Options
+		want string
+	}{
+		{Options{FirstLineAsTitle: true}, `<h1>My <em>first</em> post</h1><p>Body text.</p><h1>More</h1>`},
+		{Options{FirstLineAsTitle: true, TitleTag: "h2"}, `<h2>My <em>first</em> post</h2><p>Body text.</p><h1>More</h1>`},
+		{Options{FirstLineAsTitle: true, TitleTag: "h2 onclick=x"}, `<h1>My <em>first</em> post</h1><p>Body text.</p><h1>More</h1>`},
+		{Options{}, `<ul><li class="align-center">My <em>first</em> post</li></ul><p>Body text.</p><h1>More</h1>`},
+	}
+	for i, tc := range cases {
+		got, err := RenderWithOptions(ops, tc.opts)
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+		if string(got) != tc.want {
+			t.Errorf("(case %d) expected %q but got %q", i, tc.want, got)
+		}
+	}
+
+	// Leading empty lines are skipped, and the id of the title line is kept.
+	ops = []byte(`[{"insert":"\n\nTitle"},{"attributes":{"id":"t1"},"insert":"\n"},{"insert":"\nText\n"}]`)
+	cases = []struct {
+		opts Options
+		want string
+	}{
+		{Options{FirstLineAsTitle: true}, `<h1>Title</h1><p><br></p><p>Text</p>`},
+		{Options{FirstLineAsTitle: true, BlockIDs: true}, `<h1 id="t1">Title</h1><p><br></p><p>Text</p>`},
+	}
+	for i, tc := range cases {
+		got, err := RenderWithOptions(ops, tc.opts)
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+		if string(got) != tc.want {
+			t.Errorf("(case %d) expected %q but got %q", i, tc.want, got)
+		}
+	}
+
+}
+
+func TestOptions_BlockIDs(t *testing.T) {
+
+	ops := []byte(`[{"insert":"One"},{"attributes":{"id":"b-1"},"insert":"\n"},{"insert":"Two"},{"attributes":{"id":"x\" onclick=\"y"},"insert":"\n"},` +
+		`{"insert":"Three"},{"attributes":{"id":"item_3","list":"bullet"},"insert":"\n"},{"insert":"Four"},{"attributes":{"id":"4"},"insert":"\n"}]`)
+
+	cases := []struct {
+		opts Options
+		want string
+	}{
+		{Options{BlockIDs: true}, `<p id="b-1">One</p><p>Two</p><ul><li id="item_3">Three</li></ul><p>Four</p>`},
+		{Options{BlockIDs: true, Sanitize: DefaultAllowlist()}, `<p id="b-1">One</p><p>Two</p><ul><li id="item_3">Three</li></ul><p>Four</p>`},
+		{Options{}, `<p>One</p><p>Two</p><ul><li>Three</li></ul><p>Four</p>`},
+	}
+	for i, tc := range cases {
+		got, err := RenderWithOptions(ops, tc.opts)
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+		if string(got) != tc.want {
+			t.Errorf("(case %d) expected %q but got %q", i, tc.want, got)
+		}
+	}
+
+}
+
+func TestOptions_Overrides_wrappers(t *testing.T) {
+
+	ops := []byte(`[{"insert":"a"},{"attributes":{"list":"bullet"},"insert":"\n"},{"insert":"b"},{"attributes":{"list":"bullet"},"insert":"\n"},` +
+		`{"insert":"x := 1"},{"attributes":{"code-block":true},"insert":"\n"},{"insert":"y := 2"},{"attributes":{"code-block":true},"insert":"\n"}]`)
+
+	opts := Options{Overrides: map[string]FormatOverride{
+		"list":       {Attrs: map[string]string{"class": "x"}},
+		"code-block": {Attrs: map[string]string{"class": "code"}},
+	}}
+	got, err := RenderWithOptions(ops, opts)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	want := "<ul class=\"x\"><li>a</li><li>b</li></ul><pre class=\"code\">x := 1\ny := 2\n</pre>"
+	if string(got) != want {
+		t.Errorf("expected %q but got %q", want, got)
+	}
+
+}
@@ -1,6 +1,7 @@
 package quill
 
 import (
+	"encoding/json"
 	"fmt"
 	"strconv"
 )
@@ -32,7 +33,12 @@ func (ro *rawOp) makeOp(o *Op) error {
 		// There should be one item in the map (the element's key being the insert type).
 		for mk := range ins {
 			o.Type = mk
-			o.Data = extractString(ins[mk])
+			if mk == "mention" {
+				// The mention formatter reads the properties of the mention object, which is given as JSON.
+				o.Data = extractJSON(ins[mk])
+			} else {
+				o.Data = extractString(ins[mk])
+			}
 			break
 		}
 	default:
@@ -64,7 +70,18 @@ func extractString(v interface{}) string {
 			return "y"
 		}
 	case float64:
-		return strconv.FormatFloat(val, 'f', 0, 64)
+		// A number (such as a header level or an indent) is written like JSON writes it, without rounding.
+		return strconv.FormatFloat(val, 'f', -1, 64)
 	}
 	return ""
 }
+
+// extractJSON gives an object as JSON and any other value as extractString does.
+func extractJSON(v interface{}) string {
+	if obj, ok := v.(map[string]interface{}); ok {
+		if b, err := json.Marshal(obj); err == nil {
+			return string(b)
+		}
+	}
+	return extractString(v)
+}
@@ -35,6 +35,13 @@ func TestRawOp_makeOp(t *testing.T) {
 				"image": "url-or-base64",
 			},
 		},
+		{
+			Insert: "\n",
+			Attrs: map[string]interface{}{
+				"header": float64(2),
+				"indent": float64(1),
+			},
+		},
 	}
 
 	want := []Op{
@@ -68,6 +75,14 @@ func TestRawOp_makeOp(t *testing.T) {
 			Type:  "image",
 			Attrs: make(map[string]string), // like in code (already initialized)
 		},
+		{
+			Data: "\n",
+			Type: "text",
+			Attrs: map[string]string{
+				"header": "2",
+				"indent": "1",
+			},
+		},
 	}
 
 	o := new(Op)                         // reuse in loop
@@ -100,4 +115,19 @@ func TestExtractString(t *testing.T) {
 	if extractString(float64(3)) != "3" {
 		t.Errorf("failed float64 extract")
 	}
+	if extractString(1.5) != "1.5" {
+		t.Errorf("failed fractional float64 extract")
+	}
+	if extractString(map[string]interface{}{"id": "1", "value": "Fred"}) != "" {
+		t.Errorf("failed object extract")
+	}
+}
+
+func TestExtractJSON(t *testing.T) {
+	if extractJSON(map[string]interface{}{"id": "1", "value": "Fred"}) != `{"id":"1","value":"Fred"}` {
+		t.Errorf("failed object extract")
+	}
+	if extractJSON("random string") != "random string" {
+		t.Errorf("failed string extract")
+	}
 }
@@ -0,0 +1,103 @@
+package quill
+
+import (
+	"sort"
+	"sync"
+)
+
+// registered holds the formats added with RegisterInlineFormat and RegisterBlockFormat.
+var registered struct {
+	sync.RWMutex
+	formats map[string]registeredFormat
+}
+
+// A registeredFormat gives the Format for an attribute value.
+type registeredFormat struct {
+	fm    func(value string) Format
+	block bool
+}
+
+// RegisterInlineFormat registers an inline format for the attribute named keyword so that a Formatter does not need to
+// be written for it. The fm function gives the Format to apply to text with the attribute set to a given value; the Block
+// field of the Format is set to false. Registered formats take precedence over the built-in formats but not over the
+// formats given by a function passed to RenderExtended. Calling RegisterInlineFormat with a nil fm removes the format.
+func RegisterInlineFormat(keyword string, fm func(value string) Format) {
+	register(keyword, fm, false)
+}
+
+// RegisterBlockFormat registers a block-level format for the attribute named keyword in the same way as RegisterInlineFormat
+// registers an inline format, except that the Block field of the Format is set to true.
+func RegisterBlockFormat(keyword string, fm func(value string) Format) {
+	register(keyword, fm, true)
+}
+
+func register(keyword string, fm func(string) Format, block bool) {
+	registered.Lock()
+	defer registered.Unlock()
+	if fm == nil {
+		delete(registered.formats, keyword)
+		return
+	}
+	if registered.formats == nil {
+		registered.formats = make(map[string]registeredFormat)
+	}
+	registered.formats[keyword] = registeredFormat{fm, block}
+}
+
+// RegisteredFormats returns the sorted keywords (types and attribute names) that are recognized without custom formats:
+// the built-in formats and the formats added with RegisterInlineFormat and RegisterBlockFormat. Consumers can use the
+// list to validate the attributes of incoming Deltas.
+func RegisteredFormats() []string {
+	registered.RLock()
+	defer registered.RUnlock()
+	keywords := make([]string, len(builtinFormats), len(builtinFormats)+len(registered.formats))
+	copy(keywords, builtinFormats)
+	for k := range registered.formats {
+		if !isBuiltinFormat(k) {
+			keywords = append(keywords, k)
+		}
+	}
+	sort.Strings(keywords)
+	return keywords
+}
+
+func isBuiltinFormat(keyword string) bool {
+	for _, b := range builtinFormats {
+		if b == keyword {
+			return true
+		}
+	}
+	return false
+}
+
+// registeredFormatter returns a Formatter for the keyword if a format is registered for it, and nil otherwise.
+func registeredFormatter(keyword string, o *Op) Formatter {
+	registered.RLock()
+	rf, ok := registered.formats[keyword]
+	registered.RUnlock()
+	if !ok {
+		return nil
+	}
+	fm := rf.fm(o.Attrs[keyword])
+	fm.Block = rf.block
+	return &attrFormat{
+		attr: keyword,
+		val:  o.Attrs[keyword],
+		fm:   fm,
+	}
+}
+
+// An attrFormat is a Formatter for an attribute that gives the same Format for a given attribute value.
+type attrFormat struct {
+	attr, val string
+	fm        Format
+}
+
+func (af *attrFormat) Fmt() *Format {
+	fm := af.fm
+	return &fm
+}
+
+func (af *attrFormat) HasFormat(o *Op) bool {
+	return o.Attrs[af.attr] == af.val
+}
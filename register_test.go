@@ -0,0 +1,63 @@
+package quill
+
+import "testing"
+
+func TestRegisterFormats(t *testing.T) {
+
+	RegisterInlineFormat("highlight", func(value string) Format {
+		return Format{Val: "hl-" + value, Place: Class}
+	})
+	RegisterBlockFormat("callout", func(string) Format {
+		return Format{Val: "aside", Place: Tag}
+	})
+	defer RegisterInlineFormat("highlight", nil)
+	defer RegisterBlockFormat("callout", nil)
+
+	ops := []byte(`[{"insert":"Note: "},{"attributes":{"highlight":"yellow"},"insert":"important"},
+		{"attributes":{"callout":true},"insert":"\n"},{"insert":"plain\n"}]`)
+
+	got, err := Render(ops)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if want := `<aside>Note: <span class="hl-yellow">important</span></aside><p>plain</p>`; string(got) != want {
+		t.Errorf("expected %q but got %q", want, got)
+	}
+
+	// After removing the formats, the attributes are ignored.
+	RegisterInlineFormat("highlight", nil)
+	RegisterBlockFormat("callout", nil)
+
+	got, err = Render(ops)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if want := `<p>Note: important</p><p>plain</p>`; string(got) != want {
+		t.Errorf("expected %q but got %q", want, got)
+	}
+
+}
+
+func TestRegisteredFormats(t *testing.T) {
+
+	RegisterInlineFormat("highlight", func(value string) Format {
+		return Format{Val: "hl-" + value, Place: Class}
+	})
+	defer RegisterInlineFormat("highlight", nil)
+
+	got := make(map[string]bool)
+	for _, k := range RegisteredFormats() {
+		if got[k] {
+			t.Errorf("keyword %q listed more than once", k)
+		}
+		got[k] = true
+	}
+
+	for _, k := range []string{"text", "header", "list", "blockquote", "link", "bold", "italic", "code-block", "highlight",
+		"keyboard", "mark", "details", "abbr"} {
+		if !got[k] {
+			t.Errorf("keyword %q not listed", k)
+		}
+	}
+
+}
@@ -1,17 +1,22 @@
 // Package quill takes a Quill-based Delta (https://github.com/quilljs/delta) as a JSON array of `insert` operations
-// and renders the defined HTML document.
+// (or an object with the array as its "ops" field) and renders the defined HTML document.
 //
 // This library is designed to be easily extendable. Simply call RenderExtended with a function that may provide its
 // own formats for certain kinds of ops and attributes.
+//
+// Rendering is deterministic: HTML attributes, CSS properties, and nested formats are always written in the same order
+// regardless of the order of the attributes of ops, so the output for a given Delta can be compared in golden-file tests.
 package quill
 
 import (
 	"bytes"
-	"encoding/json"
-	"fmt"
+	"html"
 	"io"
-	"strconv"
+	"sort"
 	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
 )
 
 // Render takes a Delta array of insert operations and returns the rendered HTML using the built-in settings.
@@ -20,114 +25,526 @@ func Render(ops []byte) ([]byte, error) {
 	return RenderExtended(ops, nil)
 }
 
+// defaultFormats holds the function set by SetDefaultFormats.
+var defaultFormats struct {
+	sync.RWMutex
+	fn func(string, *Op) Formatter
+}
+
+// SetDefaultFormats sets a function that may provide a Formatter to customize the way certain kinds of inserts are
+// rendered (just like the function given to RenderExtended) whenever no such function is given for a render. This way,
+// an application can configure its formats once (typically in an init function) and simply call Render. Calling
+// SetDefaultFormats with nil removes the default.
+func SetDefaultFormats(fn func(string, *Op) Formatter) {
+	defaultFormats.Lock()
+	defaultFormats.fn = fn
+	defaultFormats.Unlock()
+}
+
+// getDefaultFormats returns the function set by SetDefaultFormats.
+func getDefaultFormats() func(string, *Op) Formatter {
+	defaultFormats.RLock()
+	defer defaultFormats.RUnlock()
+	return defaultFormats.fn
+}
+
 // RenderExtended takes a Delta array of insert operations and, optionally, a function that may provide a Formatter to
 // customize the way certain kinds of inserts are rendered, and returns the rendered HTML. If the given Formatter is nil,
 // then the default one that is built in is used. If an error occurs while rendering, any HTML already rendered is returned.
 func RenderExtended(ops []byte, customFormats func(string, *Op) Formatter) ([]byte, error) {
+	return RenderWithOptions(ops, Options{CustomFormats: customFormats})
+}
+
+// RenderWithOptions takes a Delta array of insert operations and returns the HTML rendered according to opts.
+// If an error occurs while rendering, any HTML already rendered is returned.
+func RenderWithOptions(ops []byte, opts Options) ([]byte, error) {
+	var buf bytes.Buffer
+	err := render(&buf, ops, opts)
+	return buf.Bytes(), err
+}
+
+// A RenderResult is the result of RenderWithResult.
+type RenderResult struct {
+	HTML []byte // the rendered HTML
+
+	// Formats counts the number of ops to which each format keyword (an insert type or attribute name) was applied if
+	// the CountFormats option is set. Keywords for which no Formatter is found are not counted.
+	Formats map[string]int
+}
+
+// RenderWithResult works like RenderWithOptions but returns the HTML in a RenderResult along with information about the
+// content of the Delta. If an error occurs while rendering, any HTML already rendered is returned.
+func RenderWithResult(ops []byte, opts Options) (RenderResult, error) {
+	var res RenderResult
+	if opts.CountFormats {
+		res.Formats = make(map[string]int)
+	}
+	opts.formats = res.Formats
+	var buf bytes.Buffer
+	err := render(&buf, ops, opts)
+	res.HTML = buf.Bytes()
+	return res, err
+}
+
+// RenderWithFormatMap works like RenderExtended but takes a map from keywords (insert types and attribute names) to
+// functions that provide a Formatter for ops with the keyword, which is more convenient than a function with a big switch
+// for simple mappings.
+func RenderWithFormatMap(ops []byte, formats map[string]func(*Op) Formatter) ([]byte, error) {
+	return RenderWithOptions(ops, Options{FormatMap: formats})
+}
+
+// RenderAppend works like RenderExtended but appends the rendered HTML to dst instead of returning it, which lets callers
+// assemble a larger document in their own buffer without copying. If an error occurs while rendering, any HTML already
+// rendered is left in dst.
+func RenderAppend(dst *bytes.Buffer, ops []byte, customFormats func(string, *Op) Formatter) error {
+	return render(dst, ops, Options{CustomFormats: customFormats})
+}
+
+// RenderBlocks works like RenderExtended but returns the HTML of each top-level block element as a separate string. A
+// block-level FormatWrapper (such as a list) together with all of its contents is a single block. Any inline content that
+// is not followed by a line feed forms its own block at the end.
+func RenderBlocks(ops []byte, customFormats func(string, *Op) Formatter) ([]string, error) {
+	var buf bytes.Buffer
+	var blocks []string
+	opts := Options{
+		CustomFormats: customFormats,
+		blockEnd: func() {
+			if buf.Len() > 0 {
+				blocks = append(blocks, buf.String())
+				buf.Reset()
+			}
+		},
+	}
+	err := render(&buf, ops, opts)
+	return blocks, err
+}
+
+// render writes the HTML rendered from a Delta array of insert operations according to opts to dst.
+func render(dst *bytes.Buffer, ops []byte, opts Options) error {
+
+	raw, err := parseDelta(ops)
+	if err != nil {
+		return err
+	}
+
+	return renderOps(dst, raw, opts)
+
+}
+
+// renderOps writes the HTML rendered from the parsed Delta insert operations according to opts to dst.
+func renderOps(dst *bytes.Buffer, raw []rawOp, opts Options) error {
+
+	vars := newRenderVars(dst, opts)
+	vars.startDocument(dst)
+	start := dst.Len()
+
+	if len(raw) == 0 {
+		dst.WriteString(opts.EmptyDocument)
+	}
+
+	if err := vars.writeOps(raw); err != nil {
+		vars.sanitize(start)
+		return err
+	}
+
+	vars.closeAll()
+	vars.sanitize(start)
+	vars.endDocument()
+
+	return nil
+
+}
+
+// newRenderVars sets up the variables for a render according to opts to dst.
+func newRenderVars(dst *bytes.Buffer, opts Options) *renderVars {
+
+	if opts.CustomFormats == nil {
+		opts.CustomFormats = getDefaultFormats()
+	}
 
-	raw := make([]rawOp, 0, 12)
-	if err := json.Unmarshal(ops, &raw); err != nil {
-		return nil, err
+	if opts.Footnotes != nil {
+		opts.Footnotes.notes = opts.Footnotes.notes[:0] // Drop any footnotes left by a render that failed.
 	}
 
-	vars := renderVars{
-		fs:  make(formatState, 0, 4),
-		fms: make([]*Format, 0, 4),
-		o:   Op{Attrs: make(map[string]string, 3)},
+	if opts.ContinueLists {
+		opts.listItems = new(int)
 	}
 
+	return &renderVars{
+		finalBuf: dst,
+		fs:       make(formatState, 0, 4),
+		fms:      make([]*Format, 0, 4),
+		o:        Op{Attrs: make(map[string]string, 3)},
+		opts:     opts,
+	}
+
+}
+
+// writeOps writes the parsed Delta insert operations.
+func (vars *renderVars) writeOps(raw []rawOp) error {
+
+	var feeds [][]lineFeed
+	if vars.opts.SoftBreaks {
+		feeds = vars.softLineFeeds(raw)
+	}
+
+	code := codeParts(raw)
+
 	for i := range raw {
 
+		if feeds != nil {
+			vars.lineFeeds = feeds[i]
+		}
+		if code != nil {
+			vars.codeParts = code[i]
+		}
+
 		if err := raw[i].makeOp(&vars.o); err != nil {
-			return vars.finalBuf.Bytes(), err
+			return opError(raw, i, err)
 		}
 
-		vars.fms = vars.fms[:0] // Reset the slice for the current Op iteration.
+		if vars.opts.StripInvisible && vars.o.Type == "text" {
+			vars.o.Data = stripInvisible(vars.o.Data)
+		}
 
-		// To set up fms, first check the Op insert type.
-		typeFmTer := vars.o.getFormatter(vars.o.Type, customFormats)
-		if typeFmTer == nil {
-			return vars.finalBuf.Bytes(), fmt.Errorf("quill: an op does not have a format defined for its type: %v", raw[i])
+		if vars.opts.Filter != nil && !vars.opts.Filter(&vars.o) {
+			// Skipping the line feed that ends a line means skipping the whole line.
+			if strings.IndexByte(vars.o.Data, '\n') != -1 {
+				vars.discardLine()
+			}
+			continue
 		}
-		vars.o.addFmTer(&vars, typeFmTer)
 
-		// Get a Formatter out of each of the attributes.
-		for attr := range vars.o.Attrs {
-			vars.o.addFmTer(&vars, vars.o.getFormatter(attr, customFormats))
+		if !vars.writeOp() {
+			switch vars.opts.UnknownTypePolicy {
+			case UnknownTypeSkip:
+			case UnknownTypeRaw:
+				vars.o.Type = "text"
+				vars.writeOp()
+			default:
+				return opError(raw, i, errNoTypeFormat(raw[i]))
+			}
 		}
 
-		// Open a block element, write its body, and close it to move on only when the ending "\n" of the block is reached.
-		if strings.IndexByte(vars.o.Data, '\n') != -1 {
+	}
 
-			// Extract text from between the block-terminating line feeds and write each part as its own Op.
-			split := strings.Split(vars.o.Data, "\n")
+	return nil
 
-			for j := range split {
+}
 
-				vars.o.Data = split[j]
+// closeAll writes any content not yet followed by a line feed as a block of its own and then closes all open formats,
+// so that the final buffer holds well-formed HTML.
+func (vars *renderVars) closeAll() {
 
-				// If the current o.Data still has an "\n" following (its not the last in split), then it ends a block.
-				if j < len(split)-1 {
+	// Content that is not followed by a line feed is written as a block of its own, as if the Delta ended with a line feed.
+	if vars.tempBuf.Len() > 0 {
+		vars.o.Type, vars.o.Data = "text", "\n"
+		vars.lineFeeds = nil
+		for k := range vars.o.Attrs {
+			delete(vars.o.Attrs, k)
+		}
+		vars.writeOp()
+	}
 
-					vars.o.writeBlock(&vars)
+	// Before writing out the final buffer, close the last remaining tags set by a FormatWrapper.
+	// The FormatWrapper should see that all styling is now done.
+	vars.fs.closePrevious(vars.finalBuf, blankOp(), true)
+	vars.endBlock()
 
-				} else if vars.o.Data != "" { // If the last element in split is just "" then the last character in the rawOp is "\n".
+}
 
-					vars.o.writeInline(&vars)
+// sanitize cleans the HTML written to the final buffer after the offset from with the Sanitize allowlist, if it is set.
+func (vars *renderVars) sanitize(from int) {
+	if vars.opts.Sanitize == nil {
+		return
+	}
+	clean := vars.opts.Sanitize.Sanitize(vars.finalBuf.Bytes()[from:])
+	vars.finalBuf.Truncate(from)
+	vars.finalBuf.Write(clean)
+}
 
-				}
+// startDocument writes to buf what comes before the content of the document: the opening tag of the Container.
+func (vars *renderVars) startDocument(buf *bytes.Buffer) {
+	tag := vars.opts.containerTag()
+	if tag == "" {
+		return
+	}
+	buf.WriteByte('<')
+	buf.WriteString(tag)
+	if dir := vars.opts.documentDir(); dir != "" {
+		writeAttrs(buf, map[string]string{"dir": dir})
+	}
+	buf.WriteByte('>')
+}
+
+// endDocument writes what comes after the content of the document.
+func (vars *renderVars) endDocument() {
+	if vars.opts.Footnotes != nil {
+		vars.opts.Footnotes.writeList(vars.finalBuf)
+	}
+	vars.writeStyleSheet(vars.finalBuf)
+	if tag := vars.opts.containerTag(); tag != "" {
+		closeTag(vars.finalBuf, tag)
+	}
+	if vars.opts.DocumentEnd != nil {
+		vars.opts.DocumentEnd(vars.finalBuf)
+	}
+}
+
+// renderVars combines the variables created in RenderExtended into a single allocation.
+type renderVars struct {
+	finalBuf *bytes.Buffer // the final output
+	tempBuf  bytes.Buffer  // temporary buffer reused for each block element
+	fs       formatState   // the tags currently open in the order in which they were opened
+	fms      []*Format     // reused slice for the the Formatter types defined for each Op
+	o        Op            // an Op to reuse for all iterations
+	attrs    []string      // reused slice for the sorted attribute names of each Op
+	opts     Options       // the settings of the render
+	embed    FormatWriter  // the FormatWriter of the current Op (if it has one) that is yet to be written
+
+	emptyLines int  // the number of consecutive empty paragraphs that have just been written
+	titled     bool // whether the title has been written (if FirstLineAsTitle is set)
+
+	out    func(*bytes.Buffer) error // if set (by a Stream), writes out and empties a buffer
+	outErr error                     // the first error given by out
+
+	styleRules map[string]string // the style declarations of the classes generated for styles (if StyleNonce is set)
+
+	lineFeeds     []lineFeed // what each line feed of the current Op does (if SoftBreaks is set)
+	lineStarted   bool       // whether any text or embed has been written in the current line
+	leadingSpaces [][2]int   // the spans of spaces at the start of the current line in tempBuf (if PreserveLeadingSpaces is set)
+
+	trailingSpaces [][2]int // the spans of whitespace at the end of the current line in tempBuf (if TrimTrailingSpace is set)
+	tabs           []int    // the positions of the tabs in the current line in tempBuf (if TabWidth is set)
+
+	codeParts []bool // whether each part of the text of the current Op between line feeds is in a line of a code block
+	inCode    bool   // whether the text being written is in a line of a code block
 
+	figures [][2]int // the spans of the figures of captioned images in the current line in tempBuf (if ImageCaptions is set)
+}
+
+// codePart says if the part at index j of the text of the current Op between line feeds is in a line of a code block.
+func (vars *renderVars) codePart(j int) bool {
+	return j < len(vars.codeParts) && vars.codeParts[j]
+}
+
+// codeParts gives, for each op, whether each part of its text between line feeds is in a line of a code block (that is,
+// a line ended by a line feed with the "code-block" attribute), or nil if there are no code blocks. Text in a line that
+// is not ended within raw is not known to be in a code block.
+func codeParts(raw []rawOp) [][]bool {
+
+	var parts [][]bool
+	set := func(op, part, n int) {
+		if parts == nil {
+			parts = make([][]bool, len(raw))
+		}
+		if parts[op] == nil {
+			parts[op] = make([]bool, n)
+		}
+		parts[op][part] = true
+	}
+
+	var pending [][3]int // the op index, part index, and number of parts of the text in the current line
+	for i := range raw {
+		s, ok := raw[i].Insert.(string)
+		if !ok {
+			continue
+		}
+		n := strings.Count(s, "\n") + 1
+		if n == 1 {
+			pending = append(pending, [3]int{i, 0, 1})
+			continue
+		}
+		if extractString(raw[i].Attrs["code-block"]) != "" {
+			for _, p := range pending {
+				set(p[0], p[1], p[2])
 			}
+			for j := 0; j < n-1; j++ {
+				set(i, j, n)
+			}
+		}
+		pending = append(pending[:0], [3]int{i, n - 1, n})
+	}
 
-		} else {
-			vars.o.writeInline(&vars)
+	return parts
+
+}
+
+// lineFeed says what the line feed at index j among the line feeds of the current Op does.
+func (vars *renderVars) lineFeed(j int) lineFeed {
+	if j < len(vars.lineFeeds) {
+		return vars.lineFeeds[j]
+	}
+	return lineFeedBlock
+}
+
+// formatter returns the Formatter for the keyword (the type or an attribute name) of the current Op, reporting it to the
+// Debug hook.
+func (vars *renderVars) formatter(keyword string) Formatter {
+	fmTer := vars.o.getFormatter(keyword, &vars.opts)
+	if fmTer != nil {
+		vars.debug("format "+keyword, &vars.o)
+		if vars.opts.formats != nil {
+			vars.opts.formats[keyword]++
 		}
+	}
+	return fmTer
+}
 
+// debug reports an event to the Debug hook, if one is set.
+func (vars *renderVars) debug(event string, o *Op) {
+	if vars.opts.Debug != nil {
+		vars.opts.Debug(event, o)
 	}
+}
 
-	// Before writing out the final buffer, close the last remaining tags set by a FormatWrapper.
-	// The FormatWrapper should see that all styling is now done.
-	vars.fs.closePrevious(&vars.finalBuf, blankOp(), true)
+// invisibleOnSpace lists the attributes of formats that have no visible effect on whitespace.
+var invisibleOnSpace = map[string]bool{"bold": true, "color": true, "italic": true}
+
+// writeOp writes the current Op. If no format is defined for the type of the Op, false is returned.
+func (vars *renderVars) writeOp() bool {
+
+	o := &vars.o
+
+	vars.fms = vars.fms[:0] // Reset the slice for the current Op iteration.
+
+	// To set up fms, first check the Op insert type.
+	typeFmTer := vars.formatter(o.Type)
+	if typeFmTer == nil {
+		return false
+	}
+	o.addFmTer(vars, typeFmTer)
+
+	// Get a Formatter out of each of the attributes, in the order of attribute names so that the output does not
+	// depend on the order of iteration over the map.
+	vars.attrs = vars.attrs[:0]
+	for attr := range o.Attrs {
+		vars.attrs = append(vars.attrs, attr)
+	}
+	sort.Strings(vars.attrs)
+	blank := o.Type == "text" && strings.TrimSpace(o.Data) == "" && strings.IndexByte(o.Data, '\n') == -1
+	for _, attr := range vars.attrs {
+		fmTer := vars.formatter(attr)
+		if fmTer == nil && vars.opts.DataAttrs && !isBuiltinFormat(attr) && !vars.opts.readsAttr(attr) {
+			if df := newDataAttrFormat(attr, o.Attrs[attr]); df != nil {
+				fmTer = df
+			}
+		}
+		// Whitespace is not wrapped in a format that does not change how it looks unless the format is already open.
+		if blank && fmTer != nil && invisibleOnSpace[attr] {
+			if fm := fmTer.Fmt(); fm == nil || !vars.fs.hasSet(fm) {
+				continue
+			}
+		}
+		o.addFmTer(vars, fmTer)
+	}
+
+	// Open a block element, write its body, and close it to move on only when the ending "\n" of the block is reached.
+	if strings.IndexByte(o.Data, '\n') == -1 {
+		// An Op without any content would give only empty tags.
+		if o.Data != "" || vars.embed != nil {
+			vars.inCode = vars.codePart(0)
+			o.writeInline(vars)
+		}
+		return true
+	}
+
+	// Extract text from between the block-terminating line feeds and write each part as its own Op.
+	split := strings.Split(o.Data, "\n")
+
+	for j := range split {
+
+		o.Data = split[j]
 
-	return vars.finalBuf.Bytes(), nil
+		if o.Data != "" {
+			vars.inCode = vars.codePart(j)
+			o.writeInline(vars)
+		}
+
+		// If the current part still has an "\n" following (it's not the last in split), then it ends a block.
+		if j < len(split)-1 {
+			switch vars.lineFeed(j) {
+			case lineFeedSoft:
+				vars.rewriteLine()
+				vars.tempBuf.WriteString("<br>")
+				vars.lineStarted = false
+			case lineFeedBlock:
+				o.Data = ""
+				o.writeBlock(vars)
+			}
+		}
+
+	}
+
+	return true
 
 }
 
-// renderVars combines the variables created in RenderExtended into a single allocation.
-type renderVars struct {
-	finalBuf bytes.Buffer // the final output
-	tempBuf  bytes.Buffer // temporary buffer reused for each block element
-	fs       formatState  // the tags currently open in the order in which they were opened
-	fms      []*Format    // reused slice for the the Formatter types defined for each Op
-	o        Op           // an Op to reuse for all iterations
+// endBlock signals that a top-level block has been completely written (unless a block-level FormatWrapper is still open).
+func (vars *renderVars) endBlock() {
+	if vars.opts.blockEnd == nil {
+		return
+	}
+	for _, f := range vars.fs {
+		if f.wrap && f.Block {
+			return
+		}
+	}
+	vars.opts.blockEnd()
+}
+
+// openWrap says if the opening wrap of the FormatWrapper format fm needs to be written for o. A MergeableWrapper is not
+// opened again while an equal wrap is open.
+func (vars *renderVars) openWrap(fm *Format, o *Op) bool {
+	wr := fm.fm.(FormatWrapper)
+	if m, ok := baseFormatter(fm.fm).(MergeableWrapper); ok {
+		pre, _ := wr.Wrap()
+		for _, f := range vars.fs {
+			if f.wrap && f.Val == pre {
+				m.Merge(o)
+				return false
+			}
+		}
+	}
+	return wr.Open(vars.fs, o)
 }
 
-// addFmTer adds the format from fmTer to fms (the temporary, current Op's formats) if the format is not already set in the
-// current format state. All FormatWrapper formats are added regardless of whether they are already set on fs. Data is written
-// to the temporary buffer only.
+// discardLine drops the contents of the current line that are not yet written to the final buffer, along with the inline
+// formats opened within the line.
+func (vars *renderVars) discardLine() {
+	vars.startLine()
+	for len(vars.fs) > 0 && !vars.fs[len(vars.fs)-1].Block {
+		vars.fs = vars.fs[:len(vars.fs)-1]
+	}
+}
+
+// addFmTer adds the format from fmTer to fms (the temporary, current Op's formats). A FormatWriter is saved to be written
+// by writeInline.
 func (o *Op) addFmTer(vars *renderVars, fmTer Formatter) {
 	if fmTer == nil {
 		return
 	}
 	fm := fmTer.Fmt()
 	if fm == nil {
-		// Check if the format is a FormatWriter. If it is, just write it out and continue.
+		// Check if the format is a FormatWriter. If it is, it writes out the body instead of the Op data once the
+		// formats of the Op are open.
 		if wr, ok := fmTer.(FormatWriter); ok {
-			wr.Write(&vars.tempBuf)
+			vars.embed = wr
 			o.Data = ""
 		}
 		return
 	}
 	fm.fm = fmTer
-	if fw, ok := fmTer.(FormatWrapper); ok {
+	if _, ok := fmTer.(FormatWrapper); ok {
 		fm.wrap = true
-		fm.wrapPre, fm.wrapPost = fw.Wrap()
-		vars.fms = append(vars.fms, fm)
-		return
-	}
-	if !vars.fs.hasSet(fmTer.Fmt()) {
-		vars.fms = append(vars.fms, fm)
+	} else if fm.Place == Style && vars.opts.StyleNonce != "" {
+		class, ok := vars.styleClass(fm.Val)
+		if !ok {
+			return
+		}
+		fm.Val, fm.Place = class, Class
 	}
+	vars.fms = append(vars.fms, fm)
 }
 
 // An Op is a Delta insert operations (https://github.com/quilljs/delta#insert) that has been converted into this format for
@@ -138,53 +555,59 @@ type Op struct {
 	Attrs map[string]string // key is attribute name; value is either the attribute value or "y" (meaning true)
 }
 
+// NewTextOp returns a text Op with the given attributes, which are copied. It is useful to test a Formatter or a function
+// that gives custom formats.
+func NewTextOp(text string, attrs map[string]string) *Op {
+	o := &Op{Data: text, Type: "text", Attrs: make(map[string]string, len(attrs))}
+	for k, v := range attrs {
+		o.Attrs[k] = v
+	}
+	return o
+}
+
+// NewEmbedOp returns an Op for an embed of the given kind (such as "image") with the given value and no attributes.
+func NewEmbedOp(kind, value string) *Op {
+	return &Op{Data: value, Type: kind, Attrs: make(map[string]string)}
+}
+
 // writeBlock writes a block element (which may be nested inside another block element if it is a FormatWrapper).
 // The opening HTML tag of a block element is written to the main buffer only after the "\n" character terminating the
 // block is reached (the Op with the "\n" character holds the information about the block element).
 func (o *Op) writeBlock(vars *renderVars) {
 
 	// Close the inline formats opened within the block to the tempBuf and block formats of wrappers to finalBuf.
-	closedTemp := make(formatState, 0, 1)
+	vars.fs.closeFormats(&vars.tempBuf, vars.finalBuf, o, true)
 
-	for i := len(vars.fs) - 1; i >= 0; i-- { // Start with the last format opened.
-
-		f := vars.fs[i]
-
-		// If this format is not set on the current Op, close it.
-		if (!f.wrap && !f.fm.HasFormat(o)) || (f.wrap && f.fm.(FormatWrapper).Close(vars.fs, o, true)) {
-
-			// If we need to close a tag after which there are tags that should stay open, close the following tags for now.
-			if i < len(vars.fs)-1 {
-				for ij := len(vars.fs) - 1; ij > i; ij-- {
-					closedTemp.add(vars.fs[ij])
-					if f.wrap && f.Block {
-						vars.fs.pop(&vars.finalBuf)
-					} else {
-						vars.fs.pop(&vars.tempBuf)
-					}
-				}
-			}
+	// Whitespace is kept as it is in code blocks, which are preformatted.
+	if !o.HasAttr("code-block") {
+		vars.rewriteLine()
+	}
 
-			if f.wrap && f.Block {
-				vars.fs.pop(&vars.finalBuf)
-			} else {
-				vars.fs.pop(&vars.tempBuf)
-			}
+	// Whatever was written before this block is done unless this block is inside of an open FormatWrapper.
+	vars.endBlock()
 
+	if vars.opts.FirstLineAsTitle && !vars.titled {
+		// Empty lines before the title are left out.
+		if o.Data != "" || vars.tempBuf.Len() > 0 {
+			vars.titled = true
+			vars.writeTitle(o)
 		}
-
+		vars.startLine()
+		return
 	}
 
-	// Re-open the temporarily closed formats.
-	closedTemp.writeFormats(&vars.tempBuf)
-	vars.fs = append(vars.fs, closedTemp...) // Copy after the sorting.
-
 	var block struct {
-		tagName string
-		classes []string
-		style   string
+		tagName                 string
+		classes                 []string
+		styles                  []string
+		attrs                   map[string]string
+		contentPre, contentPost string
+		empty                   *string // the content of an empty block given by an EmptyBlockFormatter
 	}
 
+	// A block quote on a list item is written inside the item.
+	var quote *Format
+
 	// Merge all formats into a single tag.
 	for i := range vars.fms {
 		fm := vars.fms[i]
@@ -193,48 +616,260 @@ func (o *Op) writeBlock(vars *renderVars) {
 			v := fm.Val
 			switch fm.Place {
 			case Tag:
+				if _, ok := baseFormatter(fm.fm).(*blockQuoteFormat); ok && isListItem(o) {
+					quote = fm
+					break
+				}
 				// If an opening tag is not specified by the Op insert type, it may be specified by an attribute.
 				block.tagName = v // Override whatever value is set.
+				for k, av := range fm.Attrs {
+					if block.attrs == nil {
+						block.attrs = make(map[string]string, len(fm.Attrs))
+					}
+					block.attrs[k] = av
+				}
 			case Class:
 				block.classes = append(block.classes, v)
 			case Style:
-				block.style += v
+				block.styles = append(block.styles, v)
 			}
 		}
 		// Write out all of FormatWrapper opening text (if there is any).
-		if fm.wrap && fm.fm.(FormatWrapper).Open(vars.fs, o) {
+		if fm.wrap && vars.openWrap(fm, o) {
+			fm.wrapPre, fm.wrapPost = fm.fm.(FormatWrapper).Wrap()
 			fm.Val = fm.wrapPre
 			vars.fs.add(fm)
 			vars.finalBuf.WriteString(fm.Val)
 		}
+		if bc, ok := fm.fm.(blockContentFormatter); ok && fm.Block {
+			pre, post := bc.blockContent(o)
+			block.contentPre += pre
+			block.contentPost = post + block.contentPost
+		}
+		if eb, ok := baseFormatter(fm.fm).(EmptyBlockFormatter); ok && fm.Block {
+			empty := eb.EmptyContent()
+			block.empty = &empty
+		}
+		if ba, ok := fm.fm.(blockAttrsFormatter); ok && fm.Block {
+			for k, av := range ba.blockAttrs(vars.fs, o) {
+				if block.attrs == nil {
+					block.attrs = make(map[string]string)
+				}
+				block.attrs[k] = av
+			}
+		}
+	}
+
+	if block.tagName != "" {
+		vars.addBlockID(o, &block.attrs)
+	}
+
+	if quote != nil {
+		var open bytes.Buffer
+		open.WriteByte('<')
+		open.WriteString(quote.Val)
+		writeAttrs(&open, quote.Attrs)
+		open.WriteByte('>')
+		block.contentPre += open.String()
+		block.contentPost = "</" + quote.Val + ">" + block.contentPost
+	}
+
+	if vars.opts.LooseLists && block.tagName == "li" {
+		block.contentPre += "<p>"
+		block.contentPost = "</p>" + block.contentPost
 	}
 
 	// Avoid empty paragraphs and "\n" in the output for text blocks.
-	if o.Data == "" && block.tagName == "p" && vars.tempBuf.Len() == 0 {
-		o.Data = "<br>"
+	emptyBlock := o.Data == "" && vars.tempBuf.Len() == 0
+	emptyPara := emptyBlock && block.tagName == "p" && block.empty == nil
+
+	if emptyPara {
+		vars.emptyLines++
+	} else {
+		vars.emptyLines = 0
 	}
 
-	if block.tagName != "" {
+	// A paragraph of only "---" or "***" without any block formats is a divider if Dividers is set.
+	plain := len(block.classes)+len(block.styles)+len(block.attrs) == 0 && block.contentPre == ""
+	if vars.opts.Dividers && block.tagName == "p" && plain && o.Data == "" {
+		if line := vars.tempBuf.String(); line == "---" || line == "***" {
+			vars.finalBuf.WriteString("<hr>")
+			vars.startLine()
+			return
+		}
+	}
+
+	if emptyPara {
+		switch vars.opts.EmptyLineMode {
+		case EmptyLineBreak:
+			vars.finalBuf.WriteString("<br>")
+			vars.startLine()
+			return
+		case EmptyLineCollapse, EmptyLineRemove:
+			if vars.emptyLines > 1 || vars.opts.EmptyLineMode == EmptyLineRemove {
+				vars.startLine()
+				return
+			}
+		}
+	}
+
+	openTag := func(attrs map[string]string) {
+		vars.debug("open "+block.tagName, o)
 		vars.finalBuf.WriteByte('<')
 		vars.finalBuf.WriteString(block.tagName)
 		vars.finalBuf.WriteString(classesList(block.classes))
-		if block.style != "" {
+		if len(block.styles) > 0 {
+			sort.Slice(block.styles, func(i, j int) bool { return styleLess(block.styles[i], block.styles[j]) })
 			vars.finalBuf.WriteString(" style=")
-			vars.finalBuf.WriteString(strconv.Quote(block.style))
+			vars.finalBuf.WriteString(quoteAttr(strings.Join(block.styles, "")))
 		}
+		writeAttrs(vars.finalBuf, attrs)
 		vars.finalBuf.WriteByte('>')
 	}
 
-	vars.finalBuf.Write(vars.tempBuf.Bytes()) // Copy the temporary buffer to the final output.
+	if len(vars.figures) > 0 && phrasingOnly(block.tagName) {
+		// The element cannot hold the figures, so each part of the line around them gets an element of its own (with the
+		// id only on the first).
+		attrs := block.attrs
+		vars.writeParts(func() {
+			openTag(attrs)
+			vars.finalBuf.WriteString(block.contentPre)
+			attrs = withoutID(attrs)
+		}, func() {
+			vars.finalBuf.WriteString(block.contentPost)
+			closeTag(vars.finalBuf, block.tagName)
+			vars.debug("close "+block.tagName, o)
+		})
+		vars.startLine()
+		return
+	}
 
-	vars.finalBuf.WriteString(o.Data) // Copy the data of the current Op (usually just "<br>" or blank).
+	if block.tagName != "" {
+		openTag(block.attrs)
+	}
+
+	vars.finalBuf.WriteString(block.contentPre)
+
+	vars.writeLine()
+
+	if emptyPara {
+		vars.finalBuf.WriteString("<br>")
+	} else if emptyBlock && block.empty != nil {
+		vars.finalBuf.WriteString(*block.empty)
+	} else {
+		vars.writeText(vars.finalBuf, o.Data) // Copy the data of the current Op (usually blank).
+	}
+
+	vars.finalBuf.WriteString(block.contentPost)
 
 	if block.tagName != "" {
-		closeTag(&vars.finalBuf, block.tagName)
+		closeTag(vars.finalBuf, block.tagName)
+		vars.debug("close "+block.tagName, o)
 	}
 
-	vars.tempBuf.Reset()
+	vars.startLine()
+
+}
+
+// longLine is the length of a line in the temporary buffer above which a Stream writes the line out directly.
+const longLine = 32 << 10
+
+// writeLine copies the line in the temporary buffer to the final buffer. A long line rendered by a Stream that does not
+// sanitize is written out directly after the final buffer instead, so that a huge line is not copied a second time. The
+// line itself is still held whole in the temporary buffer because its block element is known only at its line feed.
+func (vars *renderVars) writeLine() {
+	if vars.out == nil || vars.opts.Sanitize != nil || vars.tempBuf.Len() < longLine {
+		vars.finalBuf.Write(vars.tempBuf.Bytes())
+		return
+	}
+	if vars.outErr == nil {
+		vars.outErr = vars.out(vars.finalBuf)
+	}
+	if vars.outErr == nil {
+		vars.outErr = vars.out(&vars.tempBuf)
+	}
+}
+
+// writeTitle writes the line in the temporary buffer as the title of the document (see Options.FirstLineAsTitle).
+func (vars *renderVars) writeTitle(o *Op) {
+	tag := vars.opts.titleTag()
+	var attrs map[string]string
+	vars.addBlockID(o, &attrs)
+	openTitle := func() {
+		vars.debug("open "+tag, o)
+		vars.finalBuf.WriteString("<" + tag)
+		writeAttrs(vars.finalBuf, attrs)
+		vars.finalBuf.WriteByte('>')
+		attrs = withoutID(attrs)
+	}
+	closeTitle := func() {
+		closeTag(vars.finalBuf, tag)
+		vars.debug("close "+tag, o)
+	}
+	if len(vars.figures) > 0 && phrasingOnly(tag) {
+		vars.writeParts(openTitle, closeTitle)
+		return
+	}
+	openTitle()
+	vars.writeLine()
+	closeTitle()
+}
+
+// writeParts writes the line in the temporary buffer with its figures outside of the elements around the rest of the
+// line: each part of the line between the figures that is not blank is written between calls to openPart and closePart.
+func (vars *renderVars) writeParts(openPart, closePart func()) {
+	b := vars.tempBuf.Bytes()
+	prev := 0
+	part := func(end int) {
+		if len(bytes.TrimSpace(b[prev:end])) > 0 {
+			openPart()
+			vars.finalBuf.Write(b[prev:end])
+			closePart()
+		}
+	}
+	for _, fig := range vars.figures {
+		part(fig[0])
+		vars.finalBuf.Write(b[fig[0]:fig[1]])
+		prev = fig[1]
+	}
+	part(len(b))
+}
 
+// phrasingOnly says if the element tag can hold only phrasing content (so not a <figure>).
+func phrasingOnly(tag string) bool {
+	switch tag {
+	case "p", "h1", "h2", "h3", "h4", "h5", "h6":
+		return true
+	}
+	return false
+}
+
+// withoutID returns attrs without the "id" attribute (which is copied only if attrs has it).
+func withoutID(attrs map[string]string) map[string]string {
+	if _, ok := attrs["id"]; !ok {
+		return attrs
+	}
+	rest := make(map[string]string, len(attrs)-1)
+	for k, v := range attrs {
+		if k != "id" {
+			rest[k] = v
+		}
+	}
+	return rest
+}
+
+// addBlockID adds the "id" attribute of the line to the attributes of its block element if BlockIDs is set and the id is
+// valid.
+func (vars *renderVars) addBlockID(o *Op, attrs *map[string]string) {
+	if !vars.opts.BlockIDs {
+		return
+	}
+	if id := o.Attrs["id"]; isBlockID(id) {
+		if *attrs == nil {
+			*attrs = make(map[string]string, 1)
+		}
+		(*attrs)["id"] = id
+	}
 }
 
 // writeInline writes to the temporary buffer.
@@ -242,6 +877,14 @@ func (o *Op) writeInline(vars *renderVars) {
 
 	vars.fs.closePrevious(&vars.tempBuf, o, false)
 
+	// A captioned image is written in a figure, outside of the inline formats of the text around it.
+	caption := vars.figcaption()
+	if caption != "" {
+		vars.fs.closeInline(&vars.tempBuf)
+		vars.figures = append(vars.figures, [2]int{vars.tempBuf.Len(), 0})
+		vars.tempBuf.WriteString("<figure>")
+	}
+
 	// Save the formats being written now separately from fs.
 	addNow := make(formatState, 0, len(vars.fms))
 
@@ -250,11 +893,12 @@ func (o *Op) writeInline(vars *renderVars) {
 		if !f.Block {
 			if f.wrap {
 				// Add FormatWrapper formats only if they need to be written now.
-				if f.fm.(FormatWrapper).Open(vars.fs, o) {
+				if vars.openWrap(f, o) {
+					f.wrapPre, f.wrapPost = f.fm.(FormatWrapper).Wrap()
 					f.Val = f.wrapPre
 					addNow.add(f)
 				}
-			} else {
+			} else if !vars.fs.hasSet(f) {
 				addNow.add(f)
 			}
 		}
@@ -263,77 +907,382 @@ func (o *Op) writeInline(vars *renderVars) {
 	addNow.writeFormats(&vars.tempBuf)
 	vars.fs = append(vars.fs, addNow...) // Copy after the sorting.
 
-	vars.tempBuf.WriteString(o.Data)
+	// An embed is written inside of the formats of its Op.
+	if vars.embed != nil {
+		vars.embed.Write(&vars.tempBuf)
+		vars.embed = nil
+		vars.lineStarted = true
+		vars.trailingSpaces = vars.trailingSpaces[:0]
+	}
+
+	if caption != "" {
+		vars.fs.closeInline(&vars.tempBuf)
+		vars.tempBuf.WriteString("<figcaption>" + html.EscapeString(caption) + "</figcaption></figure>")
+		vars.figures[len(vars.figures)-1][1] = vars.tempBuf.Len()
+	}
+
+	data := o.Data
+	if vars.opts.EmojiShortcodes != nil && !vars.inCode {
+		data = replaceShortcodes(data, vars.opts.EmojiShortcodes)
+	}
+	if vars.opts.PreserveLeadingSpaces && !vars.lineStarted {
+		// Save where the spaces are so that writeBlock can replace them if the line is not preformatted.
+		if n := len(data) - len(strings.TrimLeft(data, " ")); n > 0 {
+			start := vars.tempBuf.Len()
+			vars.tempBuf.WriteString(data[:n])
+			vars.leadingSpaces = append(vars.leadingSpaces, [2]int{start, vars.tempBuf.Len()})
+			data = data[n:]
+		}
+	}
+	if data != "" {
+		vars.lineStarted = true
+	}
+
+	// Save where the whitespace at the end is so that writeBlock can remove it if it ends the line.
+	var trailing string
+	if vars.opts.TrimTrailingSpace {
+		text := strings.TrimRightFunc(data, unicode.IsSpace)
+		if text != "" {
+			vars.trailingSpaces = vars.trailingSpaces[:0]
+		}
+		data, trailing = text, data[len(text):]
+	}
+
+	write := func(s string) { vars.writeText(&vars.tempBuf, s) }
+	if vars.inCode && vars.opts.TextEscaper == nil {
+		// Code is escaped only as much as needed so that it stays readable in the HTML.
+		write = func(s string) { writeEscaped(&vars.tempBuf, s, codeEscaper) }
+	} else if vars.opts.AutoLink && !o.HasAttr("link") {
+		write = func(s string) { writeAutoLinked(&vars.tempBuf, s, vars.opts.escapeText, vars.opts.LinkRel) }
+	}
+
+	vars.writeTabbed(data, write)
+
+	if trailing != "" {
+		start := vars.tempBuf.Len()
+		vars.writeTabbed(trailing, write)
+		vars.trailingSpaces = append(vars.trailingSpaces, [2]int{start, vars.tempBuf.Len()})
+	}
+
+}
+
+// figcaption gives the caption of the embed of the current Op if it is an image that is written in a figure, or else "".
+func (vars *renderVars) figcaption() string {
+	if imf, ok := baseFormatter(vars.embed).(*imageFormat); ok {
+		return imf.figcaption()
+	}
+	return ""
+}
+
+// writeTabbed writes the text s to the temporary buffer with write. If TabWidth is set, the tabs are written as they are
+// and their positions are saved so that writeBlock can expand them if the line is not preformatted.
+func (vars *renderVars) writeTabbed(s string, write func(string)) {
+	if vars.opts.TabWidth <= 0 {
+		write(s)
+		return
+	}
+	for {
+		i := strings.IndexByte(s, '\t')
+		if i == -1 {
+			write(s)
+			return
+		}
+		write(s[:i])
+		vars.tabs = append(vars.tabs, vars.tempBuf.Len())
+		vars.tempBuf.WriteByte('\t')
+		s = s[i+1:]
+	}
+}
+
+// rewriteLine changes the whitespace saved in the current line in the temporary buffer as the options ask: the spaces at
+// the start of the line are replaced with non-breaking spaces, the whitespace at the end is removed, and tabs are
+// expanded to non-breaking spaces.
+func (vars *renderVars) rewriteLine() {
+
+	if len(vars.leadingSpaces)+len(vars.trailingSpaces)+len(vars.tabs) == 0 {
+		return
+	}
+
+	type edit struct {
+		start, end int
+		repl       string
+	}
+	edits := make([]edit, 0, len(vars.leadingSpaces)+len(vars.trailingSpaces)+len(vars.tabs))
+	for _, span := range vars.leadingSpaces {
+		edits = append(edits, edit{span[0], span[1], strings.Repeat("&nbsp;", span[1]-span[0])})
+	}
+	for _, span := range vars.trailingSpaces {
+		edits = append(edits, edit{span[0], span[1], ""})
+	}
+	tab := strings.Repeat("&nbsp;", vars.opts.TabWidth)
+	for _, t := range vars.tabs {
+		edits = append(edits, edit{t, t + 1, tab})
+	}
+	sort.Slice(edits, func(i, j int) bool {
+		if edits[i].start != edits[j].start {
+			return edits[i].start < edits[j].start
+		}
+		return edits[i].end > edits[j].end
+	})
+
+	var line bytes.Buffer
+	b := vars.tempBuf.Bytes()
+	prev := 0
+	moved := 0
+	move := func(end int) {
+		// The figures (which have no edits in them) before end are moved along with the text around them.
+		for ; moved < len(vars.figures) && vars.figures[moved][0] < end; moved++ {
+			vars.figures[moved][0] += line.Len() - prev
+			vars.figures[moved][1] += line.Len() - prev
+		}
+	}
+	for _, e := range edits {
+		if e.start < prev {
+			continue // A tab in whitespace that is removed.
+		}
+		move(e.start)
+		line.Write(b[prev:e.start])
+		line.WriteString(e.repl)
+		prev = e.end
+	}
+	move(len(b))
+	line.Write(b[prev:])
+	vars.tempBuf.Reset()
+	line.WriteTo(&vars.tempBuf)
+
+	vars.leadingSpaces = vars.leadingSpaces[:0]
+	vars.trailingSpaces = vars.trailingSpaces[:0]
+	vars.tabs = vars.tabs[:0]
 
 }
 
+// startLine resets the state kept for the current line.
+func (vars *renderVars) startLine() {
+	vars.tempBuf.Reset()
+	vars.lineStarted = false
+	vars.leadingSpaces = vars.leadingSpaces[:0]
+	vars.trailingSpaces = vars.trailingSpaces[:0]
+	vars.tabs = vars.tabs[:0]
+	vars.figures = vars.figures[:0]
+}
+
+// writeText writes the text s of an op to buf, escaped with the TextEscaper of the options.
+func (vars *renderVars) writeText(buf *bytes.Buffer, s string) {
+	if vars.opts.TextEscaper != nil {
+		writeText(buf, vars.opts.TextEscaper(s))
+		return
+	}
+	writeEscaped(buf, s, htmlEscaper)
+}
+
+// htmlEscaper escapes text just like html.EscapeString.
+var htmlEscaper = strings.NewReplacer("&", "&amp;", "'", "&#39;", "<", "&lt;", ">", "&gt;", `"`, "&#34;")
+
+// codeEscaper escapes the text of code blocks.
+var codeEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// writeEscaped writes s escaped with r to buf as writeText does. Valid text is escaped directly into buf, so no escaped
+// copy of a long text is made.
+func writeEscaped(buf *bytes.Buffer, s string, r *strings.Replacer) {
+	if utf8.ValidString(s) {
+		r.WriteString(buf, s)
+		return
+	}
+	writeText(buf, r.Replace(s))
+}
+
+// writeText writes s to buf, replacing each byte of any invalid UTF-8 sequence with the Unicode replacement character.
+func writeText(buf *bytes.Buffer, s string) {
+	if utf8.ValidString(s) {
+		buf.WriteString(s)
+		return
+	}
+	for len(s) > 0 {
+		r, size := utf8.DecodeRuneInString(s)
+		buf.WriteRune(r) // An invalid byte gives utf8.RuneError.
+		s = s[size:]
+	}
+}
+
 // HasAttr says if the Op is not nil and has the attribute set to a non-blank value.
 func (o *Op) HasAttr(attr string) bool {
 	return o != nil && o.Attrs[attr] != ""
 }
 
+// builtinFormats lists the keywords for which getFormatter has a built-in Formatter, including those that only an option
+// enables (such as "mark").
+var builtinFormats = []string{
+	"abbr", "align", "background", "blockquote", "bold", "class", "code", "code-block", "color", "details", "formula",
+	"header", "image", "indent", "italic", "keyboard", "link", "list", "mark", "mention", "script", "size", "strike",
+	"table", "text", "underline",
+}
+
 // getFormatter returns a formatter based on the keyword (either "text" or "" or an attribute name) and the Op settings.
-// For every Op, first its Type is passed through here as the keyword, and then its attributes.
-func (o *Op) getFormatter(keyword string, customFormats func(string, *Op) Formatter) Formatter {
+// For every Op, first its Type is passed through here as the keyword, and then its attributes. If opts is nil, the
+// built-in settings are used.
+func (o *Op) getFormatter(keyword string, opts *Options) Formatter {
 
-	if customFormats != nil {
-		if custom := customFormats(keyword, o); custom != nil {
+	if opts == nil {
+		opts = new(Options)
+	}
+
+	if opts.CustomFormats != nil {
+		if custom := opts.CustomFormats(keyword, o); custom != nil {
 			return custom
 		}
 	}
 
-	switch keyword { // This is the list of currently recognized "keywords".
+	if fn, ok := opts.FormatMap[keyword]; ok && fn != nil {
+		if fmTer := fn(o); fmTer != nil {
+			return fmTer
+		}
+	}
+
+	if reg := registeredFormatter(keyword, o); reg != nil {
+		return reg
+	}
+
+	if opts.Footnotes != nil && keyword == opts.Footnotes.attr() {
+		return &footnoteFormat{fc: opts.Footnotes, body: o.Attrs[keyword]}
+	}
+
+	fmTer := o.builtinFormatter(keyword, opts)
+	if ov, ok := opts.Overrides[keyword]; ok && fmTer != nil {
+		return Wrap(fmTer, ov.apply)
+	}
+	return fmTer
+
+}
+
+// BuiltinFormatter returns the built-in Formatter (with the built-in settings) for the keyword (either "text" or an
+// insert type or an attribute name) and the Op, or nil if there is none. It is useful to customize a built-in format,
+// for example with Wrap.
+func BuiltinFormatter(keyword string, o *Op) Formatter {
+	return o.builtinFormatter(keyword, new(Options))
+}
+
+// builtinFormatter returns the built-in Formatter for the keyword and the Op settings according to opts.
+func (o *Op) builtinFormatter(keyword string, opts *Options) Formatter {
+
+	switch keyword { // This is the list of currently recognized "keywords"; keep builtinFormats in sync with it.
 	case "text":
 		return new(textFormat)
 	case "header":
 		return &headerFormat{
-			level: o.Attrs["header"],
+			level:  o.Attrs["header"],
+			offset: opts.HeadingOffset,
+			aria:   opts.AriaRoles,
 		}
 	case "list":
+		if !isListItem(o) {
+			return nil // The line is written as a paragraph (indented by its "indent" attribute, if any).
+		}
 		lf := &listFormat{
-			indent: indentDepths[o.Attrs["indent"]],
+			indent:   opts.nestingDepth(o.Attrs["indent"]),
+			checkbox: opts.ChecklistCheckboxes,
+			aria:     opts.AriaRoles,
+			attrs:    opts.ListAttrs,
+			items:    opts.listItems,
 		}
-		if o.Attrs["list"] == "bullet" {
-			lf.lType = "ul"
-		} else {
-			lf.lType = "ol"
+		lf.setType(o.Attrs["list"])
+		if lf.lType == "ol" && lf.items != nil {
+			lf.start = *lf.items + 1
 		}
 		return lf
 	case "blockquote":
-		return new(blockQuoteFormat)
+		return &blockQuoteFormat{
+			cite: o.Attrs["cite"],
+		}
 	case "align":
+		if o.Attrs["align"] == "left" {
+			return nil // Left is the default alignment.
+		}
 		return &alignFormat{
 			val: o.Attrs["align"],
 		}
 	case "image":
-		return &imageFormat{
-			src: o.Data,
+		imf := &imageFormat{
+			src:  o.Data,
+			base: opts.BaseURL,
+			lazy: opts.LazyImages,
+		}
+		if opts.ImageCaptions {
+			imf.caption = o.Attrs["caption"]
+		}
+		imf.alt, imf.width, imf.height = o.Attrs["alt"], o.Attrs["width"], o.Attrs["height"]
+		imf.sizeStyle = opts.ImageSizeMode == ImageSizeStyle
+		if opts.DataImagePlaceholder != "" && isDataURL(o.Data) {
+			imf.placeholder = opts.DataImagePlaceholder
+		}
+		return imf
+	case "mention":
+		return newMentionFormat(o.Data, opts.MentionRenderer)
+	case "formula":
+		return &formulaFormat{
+			tex:    o.Data,
+			mathML: opts.FormulaMathML,
 		}
 	case "link":
 		return &linkFormat{
-			href: o.Attrs["link"],
+			href:   o.Attrs["link"],
+			base:   opts.BaseURL,
+			button: o.HasAttr("button"),
+			rel:    opts.LinkRel,
 		}
 	case "bold":
-		return new(boldFormat)
+		return &boldFormat{
+			presentational: opts.PresentationalTags,
+		}
 	case "size":
 		return sizeFormat(o.Attrs["size"])
 	case "italic":
-		return new(italicFormat)
+		return &italicFormat{
+			presentational: opts.PresentationalTags,
+		}
 	case "underline":
 		return new(underlineFormat)
+	case "keyboard":
+		if opts.KeyboardAndMark {
+			return new(keyboardFormat)
+		}
+	case "mark":
+		if opts.KeyboardAndMark {
+			return new(markFormat)
+		}
+	case "abbr":
+		if opts.Abbreviations {
+			return &abbrFormat{
+				title: o.Attrs["abbr"],
+			}
+		}
+	case "details":
+		if opts.Details {
+			return new(detailsFormat)
+		}
 	case "color":
 		return &colorFormat{
-			c: o.Attrs["color"],
+			c:     o.Attrs["color"],
+			class: opts.ColorClasses,
+		}
+	case "class":
+		if cf := newClassFormat(o.Attrs["class"], opts.AllowedClasses); cf != nil {
+			return cf
 		}
 	case "indent":
-		return &indentFormat{
-			in: o.Attrs["indent"],
+		if d := indentDepth(o.Attrs["indent"], opts.MaxIndentDepth); d > 0 {
+			return &indentFormat{
+				in:    o.Attrs["indent"],
+				depth: d,
+			}
 		}
 	case "strike":
 		return new(strikeFormat)
+	case "code":
+		return new(codeFormat)
 	case "background":
 		return &bkgFormat{
-			c: o.Attrs["background"],
+			c:     o.Attrs["background"],
+			class: opts.ColorClasses,
 		}
 	case "script":
 		sf := new(scriptFormat)
@@ -344,7 +1293,16 @@ func (o *Op) getFormatter(keyword string, customFormats func(string, *Op) Format
 		}
 		return sf
 	case "code-block":
-		return &codeBlockFormat{o}
+		return &codeBlockFormat{
+			o:      o,
+			lang:   codeLanguage(o.Attrs["code-block"]),
+			indent: opts.nestingDepth(o.Attrs["indent"]),
+			lines:  opts.CodeLineNumbers,
+		}
+	case "table":
+		return &tableFormat{
+			row: o.Attrs["table"],
+		}
 	}
 
 	return nil
@@ -375,20 +1333,48 @@ type FormatWriter interface {
 // A FormatWrapper wraps text with additional text of any kind (such as "<ul>" for lists).
 type FormatWrapper interface {
 	Formatter
-	Wrap() (pre, post string)        // Say what opening and closing wraps will be written.
+	Wrap() (pre, post string)        // Say what opening and closing wraps will be written (called after Open returns true).
 	Open([]*Format, *Op) bool        // Given the open formats and current Op, say if to write the pre string.
 	Close([]*Format, *Op, bool) bool // Given the open formats, current Op, and if the Op closes a block, say if to write the post string.
 }
 
+// A MergeableWrapper is a FormatWrapper that declares that consecutive blocks (or inline runs) with its format are written
+// inside of a single wrap: while a wrap equal to the one it gives is open, the wrap is not opened again and Merge is called
+// instead of Open. The wrap is closed when Close says so, as with any FormatWrapper.
+type MergeableWrapper interface {
+	FormatWrapper
+	Merge(*Op) // Note that the Op is written inside of the wrap that is already open.
+}
+
+// An EmptyBlockFormatter is a block-level Formatter that gives what to write in a block that has no content (such as
+// "&nbsp;") instead of the <br> written in an empty paragraph. The content is written as it is, without escaping.
+type EmptyBlockFormatter interface {
+	Formatter
+	EmptyContent() string
+}
+
+// A blockContentFormatter is a block-level Formatter that writes text around the contents of the block element (inside
+// of its tags).
+type blockContentFormatter interface {
+	blockContent(*Op) (pre, post string)
+}
+
+// A blockAttrsFormatter is a block-level Formatter that adds HTML attributes to the block element depending on the open
+// formats (after its own FormatWrapper opening text, if any, is written).
+type blockAttrsFormatter interface {
+	blockAttrs(open []*Format, o *Op) map[string]string
+}
+
 // A Format specifies how styling to text is applied. The Val string is what is printed in the place given by Place. Block indicates
-// if this is a block-level format.
+// if this is a block-level format. Attrs may give additional attributes to write on the element of a format with Place Tag.
 type Format struct {
-	Val               string      // the value to print
-	Place             FormatPlace // where this format is placed in the text
-	Block             bool        // indicate whether this is a block-level format (not printed until a "\n" is reached)
-	wrap              bool        // indicates whether this format was written as a FormatWrapper
-	wrapPre, wrapPost string      // If this Format is a wrap, then Val holds the open and wrapPost holds the close.
-	fm                Formatter   // where this instance of a Format came from
+	Val               string            // the value to print
+	Place             FormatPlace       // where this format is placed in the text
+	Block             bool              // indicate whether this is a block-level format (not printed until a "\n" is reached)
+	Attrs             map[string]string // additional HTML attributes of the element (name to unescaped value)
+	wrap              bool              // indicates whether this format was written as a FormatWrapper
+	wrapPre, wrapPost string            // If this Format is a wrap, then Val holds the open and wrapPost holds the close.
+	fm                Formatter         // where this instance of a Format came from
 }
 
 // A blankOp can be used to signal any FormatWrapper formats to write the final closing wrap.
@@ -400,11 +1386,34 @@ func blankOp() *Op {
 // "class" attribute and spaces between each class name.
 func classesList(cl []string) string {
 	if len(cl) > 0 {
-		return " class=" + strconv.Quote(strings.Join(cl, " "))
+		return " class=" + quoteAttr(strings.Join(cl, " "))
 	}
 	return ""
 }
 
+// writeAttrs writes the HTML attributes in attrs to buf, each with a space before it, in the order of attribute names.
+func writeAttrs(buf *bytes.Buffer, attrs map[string]string) {
+	if len(attrs) == 0 {
+		return
+	}
+	names := make([]string, 0, len(attrs))
+	for k := range attrs {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	for _, k := range names {
+		buf.WriteByte(' ')
+		buf.WriteString(k)
+		buf.WriteByte('=')
+		buf.WriteString(quoteAttr(attrs[k]))
+	}
+}
+
+// quoteAttr returns v escaped for use as an HTML attribute value and enclosed in double quotes.
+func quoteAttr(v string) string {
+	return `"` + html.EscapeString(v) + `"`
+}
+
 // closeTag writes a complete closing tag to buf.
 func closeTag(buf *bytes.Buffer, tagName string) {
 	buf.WriteString("</")
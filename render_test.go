@@ -2,6 +2,7 @@ package quill
 
 import (
 	"bytes"
+	"io"
 	"io/ioutil"
 	"strconv"
 	"testing"
@@ -21,6 +22,10 @@ func TestSimple(t *testing.T) {
 			ops:  `[{"insert": "line1\nline2\n"}]`,
 			want: "<p>line1</p><p>line2</p>",
 		},
+		"escaped text": {
+			ops:  `[{"insert": "<b>1 & 2</b>"}, {"attributes": {"bold": true}, "insert": "\"hi\""}, {"insert": "\n"}]`,
+			want: "<p>&lt;b&gt;1 &amp; 2&lt;/b&gt;<strong>&#34;hi&#34;</strong></p>",
+		},
 		"blank line": {
 			ops:  `[{"insert": "line1\n\nline3\n"}]`,
 			want: "<p>line1</p><p><br></p><p>line3</p>",
@@ -29,6 +34,10 @@ func TestSimple(t *testing.T) {
 			ops:  `[{"insert": "bkqt"}, {"attributes": {"blockquote": true}, "insert": "\n"}]`,
 			want: "<blockquote>bkqt</blockquote>",
 		},
+		"blockquote with cite": {
+			ops:  `[{"insert": "bkqt"}, {"attributes": {"blockquote": true, "cite": "https://example.com/?a=1&b=\"2\""}, "insert": "\n"}]`,
+			want: `<blockquote cite="https://example.com/?a=1&amp;b=&#34;2&#34;">bkqt</blockquote>`,
+		},
 		"color": {
 			ops:  `[{"attributes": {"color": "#a10000"}, "insert": "colored"}, {"insert": "\n"}]`,
 			want: `<p><span style="color:#a10000;">colored</span></p>`,
@@ -49,6 +58,85 @@ func TestSimple(t *testing.T) {
 			ops:  `[{"insert":"text "},{"insert":{"image":"source-url"}},{"insert":" more text\n"}]`,
 			want: `<p>text <img src="source-url"> more text</p>`,
 		},
+		"image then text": {
+			ops:  `[{"insert":"before\n"},{"insert":{"image":"source-url"}},{"insert":"text\n"}]`,
+			want: `<p>before</p><p><img src="source-url">text</p>`,
+		},
+		"image after bold": {
+			ops:  `[{"attributes":{"bold":true},"insert":"bold"},{"insert":{"image":"source-url"}},{"insert":"\n"}]`,
+			want: `<p><strong>bold</strong><img src="source-url"></p>`,
+		},
+		"image linked": {
+			ops:  `[{"attributes":{"link":"https://widerwebs.com"},"insert":{"image":"source-url"}},{"insert":"\n"}]`,
+			want: `<p><a href="https://widerwebs.com" target="_blank"><img src="source-url"></a></p>`,
+		},
+		"image object": {
+			ops:  `[{"insert":"a "},{"insert":{"image":{"src":"source-url","alt":"x"}}},{"insert":"\n"}]`,
+			want: `<p>a <img src=""></p>`,
+		},
+		"link to fragment": {
+			ops:  `[{"attributes":{"link":"#top"},"insert":"top"},{"insert":"\n"}]`,
+			want: `<p><a href="#top" target="_blank">top</a></p>`,
+		},
+		"link relative with fragment": {
+			ops:  `[{"attributes":{"link":"page.html#sec"},"insert":"section"},{"insert":"\n"}]`,
+			want: `<p><a href="page.html#sec" target="_blank">section</a></p>`,
+		},
+		"link with disallowed scheme": {
+			ops:  `[{"attributes":{"link":"javascript:alert(1)"},"insert":"click"},{"insert":"\n"}]`,
+			want: `<p><a href="about:blank" target="_blank">click</a></p>`,
+		},
+		"inline code": {
+			ops:  `[{"insert":"call "},{"attributes":{"code":true},"insert":"f()"},{"insert":"\n"}]`,
+			want: `<p>call <code>f()</code></p>`,
+		},
+		"stacking order": {
+			ops:  `[{"attributes":{"code":true,"bold":true,"color":"red","link":"https://widerwebs.com"},"insert":"stacked"},{"insert":"\n"}]`,
+			want: `<p><a href="https://widerwebs.com" target="_blank"><span style="color:red;"><strong><code>stacked</code></strong></span></a></p>`,
+		},
+		"no line feed": {
+			ops:  `[{"insert":"text"}]`,
+			want: "<p>text</p>",
+		},
+		"no line feed after list": {
+			ops:  `[{"insert":"item"},{"attributes":{"list":"bullet"},"insert":"\n"},{"attributes":{"bold":true},"insert":"text"}]`,
+			want: "<ul><li>item</li></ul><p><strong>text</strong></p>",
+		},
+		"formats across lines": {
+			ops:  `[{"attributes":{"bold":true},"insert":"x"},{"attributes":{"bold":true},"insert":"a\nb"},{"insert":"\n"}]`,
+			want: "<p><strong>xa</strong></p><p><strong>b</strong></p>",
+		},
+		"code block then text": {
+			ops:  `[{"insert":"code"},{"attributes":{"code-block":true},"insert":"\n"},{"insert":"plain"},{"insert":"\n"}]`,
+			want: "<pre>code\n</pre><p>plain</p>",
+		},
+		"code block with language": {
+			ops: `[{"insert":"let x = 1;"},{"attributes":{"code-block":"javascript"},"insert":"\n"},{"insert":"x < 2"},{"attributes":{"code-block":"javascript"},"insert":"\n"},
+				{"insert":"x = 3"},{"attributes":{"code-block":"python"},"insert":"\n"},{"insert":"plain"},{"attributes":{"code-block":"plain"},"insert":"\n"}]`,
+			want: "<pre><code class=\"language-javascript\">let x = 1;\nx &lt; 2\n</code></pre><pre><code class=\"language-python\">x = 3\n</code></pre><pre>plain\n</pre>",
+		},
+		"bold space between words": {
+			ops:  `[{"insert":"a"},{"attributes":{"bold":true},"insert":" "},{"insert":"b"},{"attributes":{"bold":true},"insert":"c"},{"attributes":{"bold":true},"insert":" "},{"attributes":{"underline":true},"insert":" "},{"insert":"d\n"}]`,
+			want: `<p>a b<strong>c </strong><u> </u>d</p>`,
+		},
+		"button link": {
+			ops:  `[{"attributes":{"link":"/signup","button":true},"insert":"Sign up"},{"attributes":{"link":"/signup"},"insert":" now"},{"insert":"\n"}]`,
+			want: `<p><a class="btn" href="/signup" target="_blank">Sign up</a><a href="/signup" target="_blank"> now</a></p>`,
+		},
+		"negative indent": {
+			ops: `[{"insert":"a"},{"attributes":{"list":"ordered","indent":2},"insert":"\n"},{"insert":"b"},{"attributes":{"list":"ordered","indent":-1},"insert":"\n"},
+				{"insert":"c"},{"attributes":{"indent":-3},"insert":"\n"},{"insert":"d"},{"attributes":{"code-block":true,"indent":"-2"},"insert":"\n"}]`,
+			want: "<ol><li class=\"indent-2\">a</li><li value=\"1\">b</li></ol><p>c</p><pre>d\n</pre>",
+		},
+		"numeric header and indent": {
+			ops:  `[{"insert":"Title"},{"attributes":{"header":2,"indent":1},"insert":"\n"}]`,
+			want: `<h2 class="indent-1">Title</h2>`,
+		},
+		"code block escaping": {
+			ops: `[{"insert":"if a < b && s == \"d\" {"},{"attributes":{"code-block":true},"insert":"\n"},{"insert":"  x = 'y'"},{"attributes":{"code-block":true},"insert":"\n"},
+				{"insert":"}"},{"attributes":{"code-block":true},"insert":"\n"},{"insert":"\"q\"\n"}]`,
+			want: "<pre>if a &lt; b &amp;&amp; s == \"d\" {\n  x = 'y'\n}\n</pre><p>&#34;q&#34;</p>",
+		},
 		"background": {
 			ops:  `[{"insert":"abc "},{"attributes":{"background":"#66a3e0"},"insert":"bkg colored"},{"insert":" plain\n"}]`,
 			want: `<p>abc <span style="background-color:#66a3e0;">bkg colored</span> plain</p>`,
@@ -63,6 +151,50 @@ func TestSimple(t *testing.T) {
 				{"insert":"small","attributes":{"size":"small"}},{"insert":"\n"}]`,
 			want: `<p>stuff <span class="ql-size-large">large</span> other <span class="ql-size-small">small</span></p>`,
 		},
+		"nested ordered list": {
+			ops: `[{"insert":"a"},{"attributes":{"list":"ordered"},"insert":"\n"},{"insert":"a1"},{"attributes":{"list":"ordered","indent":1},"insert":"\n"},
+				{"insert":"a2"},{"attributes":{"list":"ordered","indent":1},"insert":"\n"},{"insert":"b"},{"attributes":{"list":"ordered"},"insert":"\n"}]`,
+			want: `<ol><li>a</li><li class="indent-1" value="1">a1</li><li class="indent-1">a2</li><li value="2">b</li></ol>`,
+		},
+		"empty formatted ops": {
+			ops:  `[{"insert":"a"},{"attributes":{"bold":true},"insert":""},{"attributes":{"link":"/x","color":"red"},"insert":""},{"insert":"b\n"}]`,
+			want: `<p>ab</p>`,
+		},
+		"indented code block": {
+			ops: `[{"insert":"if x {"},{"attributes":{"code-block":true},"insert":"\n"},{"insert":"y()"},{"attributes":{"code-block":true,"indent":1},"insert":"\n"},
+				{"insert":"}"},{"attributes":{"code-block":true},"insert":"\n"}]`,
+			want: "<pre>if x {\n\ty()\n}\n</pre>",
+		},
+		"quoted list item": {
+			ops:  `[{"insert":"a"},{"attributes":{"list":"bullet","blockquote":true},"insert":"\n"},{"insert":"b"},{"attributes":{"list":"bullet"},"insert":"\n"}]`,
+			want: `<ul><li><blockquote>a</blockquote></li><li>b</li></ul>`,
+		},
+		"list none": {
+			ops:  `[{"insert":"a"},{"attributes":{"list":"ordered"},"insert":"\n"},{"insert":"b"},{"attributes":{"list":"none","indent":1},"insert":"\n"}]`,
+			want: `<ol><li>a</li></ol><p class="indent-1">b</p>`,
+		},
+		"formula": {
+			ops:  `[{"insert":"So "},{"insert":{"formula":"a<b"}},{"insert":"\n"}]`,
+			want: `<p>So <span class="ql-formula" data-value="a&lt;b">a&lt;b</span></p>`,
+		},
+		"alignments": {
+			ops: `[{"insert":"l"},{"attributes":{"align":"left"},"insert":"\n"},{"insert":"c"},{"attributes":{"align":"center"},"insert":"\n"},
+				{"insert":"r"},{"attributes":{"align":"right"},"insert":"\n"},{"insert":"j"},{"attributes":{"align":"justify"},"insert":"\n"}]`,
+			want: `<p>l</p><p class="align-center">c</p><p class="align-right">r</p><p class="align-justify">j</p>`,
+		},
+		"images on one line": {
+			ops: `[{"insert":{"image":"a.png"}},{"attributes":{"link":"/b"},"insert":{"image":"b.png"}},{"insert":{"image":"c.png"}},
+				{"attributes":{"align":"center"},"insert":"\n"}]`,
+			want: `<p class="align-center"><img src="a.png"><a href="/b" target="_blank"><img src="b.png"></a><img src="c.png"></p>`,
+		},
+		"size length": {
+			ops:  `[{"insert":"big","attributes":{"size":"16px"}},{"insert":"\n"}]`,
+			want: `<p><span style="font-size:16px;">big</span></p>`,
+		},
+		"size injection": {
+			ops:  `[{"insert":"big","attributes":{"size":"16px; color:red"}},{"insert":"\n"}]`,
+			want: `<p>big</p>`,
+		},
 		"superscript": {
 			ops:  `[{"insert":"plain"},{"attributes":{"script":"super"},"insert":"super"},{"insert":"\n"}]`,
 			want: "<p>plain<sup>super</sup></p>",
@@ -71,6 +203,17 @@ func TestSimple(t *testing.T) {
 			ops:  `[{"insert":"plain"},{"attributes":{"script":"sub"},"insert":"sub"},{"insert":"\n"}]`,
 			want: "<p>plain<sub>sub</sub></p>",
 		},
+		"table single column": {
+			ops: `[{"insert":"before\n"},{"insert":"a1"},{"attributes":{"table":"row-1"},"insert":"\n"},
+				{"insert":"a2"},{"attributes":{"table":"row-2"},"insert":"\n"},
+				{"insert":"a3"},{"attributes":{"table":"row-3"},"insert":"\n"},{"insert":"after\n"}]`,
+			want: "<p>before</p><table><tr><td>a1</td></tr><tr><td>a2</td></tr><tr><td>a3</td></tr></table><p>after</p>",
+		},
+		"table multiple columns": {
+			ops: `[{"insert":"a1"},{"attributes":{"table":"row-1"},"insert":"\n"},{"insert":"b1"},{"attributes":{"table":"row-1"},"insert":"\n"},
+				{"insert":"a2"},{"attributes":{"table":"row-2"},"insert":"\n"},{"insert":"b2"},{"attributes":{"table":"row-2"},"insert":"\n"}]`,
+			want: "<table><tr><td>a1</td><td>b1</td></tr><tr><td>a2</td><td>b2</td></tr></table>",
+		},
 	}
 
 	for k, tc := range cases {
@@ -118,6 +261,459 @@ func TestRender(t *testing.T) {
 
 }
 
+func TestWriteText(t *testing.T) {
+	cases := map[string]string{
+		"valid":           "valid",
+		"multi-byte ✓":    "multi-byte ✓",
+		"bad\xffbyte":     "bad\uFFFDbyte",
+		"cut \xe2\x9c":    "cut \uFFFD\uFFFD",
+		"\xc0\xafslash\n": "\uFFFD\uFFFDslash\n",
+	}
+	var buf bytes.Buffer
+	for in, want := range cases {
+		writeText(&buf, in)
+		if buf.String() != want {
+			t.Errorf("for %q expected %q but got %q", in, want, buf.String())
+		}
+		buf.Reset()
+	}
+}
+
+func TestRender_invalidUTF8(t *testing.T) {
+	got, err := Render([]byte("[{\"insert\":\"bad\xff\xfebytes\\n\"}]"))
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if want := "<p>bad\uFFFD\uFFFDbytes</p>"; string(got) != want {
+		t.Errorf("expected %q but got %q", want, got)
+	}
+}
+
+// blockStyleFormat is a custom block-level style used for testing.
+type blockStyleFormat struct {
+	prop, val string
+}
+
+func (bsf *blockStyleFormat) Fmt() *Format {
+	return &Format{
+		Val:   bsf.prop + ":" + bsf.val + ";",
+		Place: Style,
+		Block: true,
+	}
+}
+
+func (bsf *blockStyleFormat) HasFormat(*Op) bool { return false }
+
+func TestRender_styleOrder(t *testing.T) {
+
+	// Inline styles are nested in the canonical order of their properties.
+	inline := `[{"attributes":{"size":"16px","background":"#66a3e0","color":"#a10000"},"insert":"styled"},{"insert":"\n"}]`
+	want := `<p><span style="color:#a10000;"><span style="background-color:#66a3e0;"><span style="font-size:16px;">styled</span></span></span></p>`
+
+	for i := 0; i < 10; i++ { // Map iteration order must not matter.
+		got, err := Render([]byte(inline))
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+		if string(got) != want {
+			t.Fatalf("bad inline style order; got: %s", got)
+		}
+	}
+
+	// Block styles are merged into a single attribute in the canonical order of their properties.
+	block := `[{"insert":"styled"},{"attributes":{"size":"16px","background":"#66a3e0","color":"#a10000"},"insert":"\n"}]`
+	want = `<p style="color:#a10000;background-color:#66a3e0;font-size:16px;">styled</p>`
+
+	props := map[string]string{"color": "color", "background": "background-color", "size": "font-size"}
+	custom := func(keyword string, o *Op) Formatter {
+		if prop, ok := props[keyword]; ok && o.Data == "\n" {
+			return &blockStyleFormat{prop, o.Attrs[keyword]}
+		}
+		return nil
+	}
+
+	for i := 0; i < 10; i++ {
+		got, err := RenderExtended([]byte(block), custom)
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+		if string(got) != want {
+			t.Fatalf("bad block style order; got: %s", got)
+		}
+	}
+
+}
+
+// smileyFormat is a custom embed used for testing.
+type smileyFormat struct{}
+
+func (*smileyFormat) Fmt() *Format { return nil }
+
+func (*smileyFormat) HasFormat(o *Op) bool { return o.Type == "smiley" }
+
+func (*smileyFormat) Write(w io.Writer) { io.WriteString(w, `<span class="smiley">:)</span>`) }
+
+func TestRender_toggleFormats(t *testing.T) {
+
+	// Each format is closed when the next op does not have it and opened again when it comes back.
+	cases := []struct {
+		attrs, open, close string
+	}{
+		{`{"bold":true}`, "<strong>", "</strong>"},
+		{`{"italic":true}`, "<em>", "</em>"},
+		{`{"underline":true}`, "<u>", "</u>"},
+		{`{"strike":true}`, "<s>", "</s>"},
+		{`{"code":true}`, "<code>", "</code>"},
+		{`{"script":"sub"}`, "<sub>", "</sub>"},
+		{`{"script":"super"}`, "<sup>", "</sup>"},
+		{`{"keyboard":true}`, "<kbd>", "</kbd>"},
+		{`{"mark":true}`, "<mark>", "</mark>"},
+		{`{"color":"red"}`, `<span style="color:red;">`, "</span>"},
+		{`{"background":"red"}`, `<span style="background-color:red;">`, "</span>"},
+		{`{"size":"large"}`, `<span class="ql-size-large">`, "</span>"},
+		{`{"link":"/x"}`, `<a href="/x" target="_blank">`, "</a>"},
+	}
+
+	for _, tc := range cases {
+		ops := `[{"attributes":` + tc.attrs + `,"insert":"a"},{"insert":"b"},{"attributes":` + tc.attrs + `,"insert":"c"},{"insert":"\n"}]`
+		got, err := RenderWithOptions([]byte(ops), Options{KeyboardAndMark: true})
+		if err != nil {
+			t.Fatalf("%s: %s", tc.attrs, err)
+		}
+		if want := "<p>" + tc.open + "a" + tc.close + "b" + tc.open + "c" + tc.close + "</p>"; string(got) != want {
+			t.Errorf("%s: expected %q but got %q", tc.attrs, want, got)
+		}
+	}
+
+	// A format with a changed value is closed too.
+	got, err := Render([]byte(`[{"attributes":{"script":"sub"},"insert":"a"},{"attributes":{"script":"super"},"insert":"b"},{"insert":"\n"}]`))
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if want := "<p><sub>a</sub><sup>b</sup></p>"; string(got) != want {
+		t.Errorf("expected %q but got %q", want, got)
+	}
+
+}
+
+// calloutFormat is a custom mergeable wrapper used for testing.
+type calloutFormat struct {
+	merged int // the number of blocks written inside of the open wrap
+}
+
+func (*calloutFormat) Fmt() *Format {
+	return &Format{
+		Val:   "p",
+		Place: Tag,
+		Block: true,
+	}
+}
+
+func (*calloutFormat) HasFormat(o *Op) bool { return o.HasAttr("callout") }
+
+func (*calloutFormat) Wrap() (string, string) { return `<div class="callout">`, "</div>" }
+
+func (*calloutFormat) Open([]*Format, *Op) bool { return true }
+
+func (*calloutFormat) Close(_ []*Format, o *Op, doingBlock bool) bool {
+	return doingBlock && !o.HasAttr("callout")
+}
+
+func (cf *calloutFormat) Merge(*Op) { cf.merged++ }
+
+func TestRender_mergeableWrapper(t *testing.T) {
+
+	ops := []byte(`[{"insert":"one"},{"attributes":{"callout":true},"insert":"\n"},{"insert":"two"},{"attributes":{"callout":true},"insert":"\n"},` +
+		`{"insert":"three"},{"attributes":{"callout":true},"insert":"\n"},{"insert":"after\n"}]`)
+
+	var made []*calloutFormat
+	custom := func(keyword string, o *Op) Formatter {
+		if keyword == "callout" {
+			cf := new(calloutFormat)
+			made = append(made, cf)
+			return cf
+		}
+		return nil
+	}
+
+	got, err := RenderExtended(ops, custom)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	want := `<div class="callout"><p>one</p><p>two</p><p>three</p></div><p>after</p>`
+	if string(got) != want {
+		t.Errorf("expected %q but got %q", want, got)
+	}
+
+	merged := 0
+	for _, cf := range made {
+		merged += cf.merged
+	}
+	if merged != 2 {
+		t.Errorf("expected 2 blocks to be merged into the open wrap but got %d", merged)
+	}
+
+}
+
+// spacerFormat is a custom block with its own content for empty lines used for testing.
+type spacerFormat struct{}
+
+func (*spacerFormat) Fmt() *Format {
+	return &Format{
+		Val:   "div",
+		Place: Tag,
+		Block: true,
+	}
+}
+
+func (*spacerFormat) HasFormat(o *Op) bool { return o.HasAttr("spacer") }
+
+func (*spacerFormat) EmptyContent() string { return "&nbsp;" }
+
+func TestRender_emptyBlockContent(t *testing.T) {
+
+	ops := []byte(`[{"insert":"\n"},{"attributes":{"spacer":true},"insert":"\n"},{"insert":"text"},{"attributes":{"spacer":true},"insert":"\n"},` +
+		`{"insert":"\n"},{"attributes":{"header":2},"insert":"\n"}]`)
+
+	custom := func(keyword string, o *Op) Formatter {
+		if keyword == "spacer" {
+			return new(spacerFormat)
+		}
+		return nil
+	}
+
+	got, err := RenderExtended(ops, custom)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	want := `<p><br></p><div>&nbsp;</div><div>text</div><p><br></p><h2></h2>`
+	if string(got) != want {
+		t.Errorf("expected %q but got %q", want, got)
+	}
+
+}
+
+func TestRender_deterministic(t *testing.T) {
+
+	ops := []byte(`[{"attributes":{"underline":true,"italic":true,"bold":true,"strike":true,"color":"red","background":"blue","size":"large"},"insert":"styled"},
+		{"attributes":{"align":"center","indent":1,"class":"lead note","blockquote":true},"insert":"\n"},
+		{"insert":"item"},{"attributes":{"list":"bullet","indent":2,"align":"right"},"insert":"\n"}]`)
+	opts := Options{AllowedClasses: []string{"lead", "note"}, AriaRoles: true}
+
+	first, err := RenderWithOptions(ops, opts)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	for i := 0; i < 50; i++ {
+		got, err := RenderWithOptions(ops, opts)
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+		if !bytes.Equal(got, first) {
+			t.Fatalf("rendering is not deterministic; got:\n%s\nand:\n%s", first, got)
+		}
+	}
+
+}
+
+// spoilerFormat is a custom inline format used for testing.
+type spoilerFormat struct{}
+
+func (*spoilerFormat) Fmt() *Format {
+	return &Format{
+		Val:   "spoiler",
+		Place: Class,
+	}
+}
+
+func (*spoilerFormat) HasFormat(o *Op) bool {
+	return o.HasAttr("spoiler")
+}
+
+func TestNewOps(t *testing.T) {
+
+	custom := func(keyword string, o *Op) Formatter {
+		switch {
+		case keyword == "spoiler":
+			return new(spoilerFormat)
+		case keyword == "smiley" && o.Type == "smiley":
+			return new(smileyFormat)
+		}
+		return nil
+	}
+
+	attrs := map[string]string{"spoiler": "y", "bold": "y"}
+	text := NewTextOp("did it", attrs)
+	attrs["spoiler"] = ""
+	if text.Type != "text" || text.Data != "did it" || text.Attrs["spoiler"] != "y" {
+		t.Errorf("unexpected text op %+v", text)
+	}
+
+	fmTer := custom("spoiler", text)
+	if fmTer == nil || !fmTer.HasFormat(text) {
+		t.Errorf("spoiler format not found for text op")
+	}
+	if fmTer.HasFormat(NewTextOp("plain", nil)) {
+		t.Errorf("spoiler format found for plain op")
+	}
+
+	embed := NewEmbedOp("smiley", "")
+	if embed.Type != "smiley" || embed.Attrs == nil {
+		t.Errorf("unexpected embed op %+v", embed)
+	}
+	if fmTer = custom(embed.Type, embed); fmTer == nil || !fmTer.HasFormat(embed) || fmTer.Fmt() != nil {
+		t.Errorf("smiley format not found for embed op")
+	}
+
+}
+
+func TestRenderWithFormatMap(t *testing.T) {
+
+	formats := map[string]func(*Op) Formatter{
+		"spoiler": func(*Op) Formatter { return new(spoilerFormat) },
+	}
+
+	got, err := RenderWithFormatMap([]byte(`[{"insert":"The butler "},{"attributes":{"spoiler":true},"insert":"did it"},{"insert":"\n"}]`), formats)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if want := `<p>The butler <span class="spoiler">did it</span></p>`; string(got) != want {
+		t.Errorf("expected %q but got %q", want, got)
+	}
+
+}
+
+func TestRenderAppend(t *testing.T) {
+
+	var buf bytes.Buffer
+	buf.WriteString("<article>")
+
+	if err := RenderAppend(&buf, []byte(`[{"insert":"line1\nline2\n"}]`), nil); err != nil {
+		t.Fatalf("%s", err)
+	}
+	buf.WriteString("</article>")
+
+	if want := "<article><p>line1</p><p>line2</p></article>"; buf.String() != want {
+		t.Errorf("expected %q but got %q", want, buf.String())
+	}
+
+}
+
+func TestRenderBlocks(t *testing.T) {
+
+	cases := []struct {
+		ops  string
+		want []string
+	}{
+		{
+			ops:  `[{"insert":"one\ntwo\n"},{"attributes":{"bold":true},"insert":"three"},{"insert":"\n"}]`,
+			want: []string{"<p>one</p>", "<p>two</p>", "<p><strong>three</strong></p>"},
+		},
+		{
+			ops: `[{"insert":"intro\na"},{"attributes":{"list":"bullet"},"insert":"\n"},{"insert":"b"},
+				{"attributes":{"list":"bullet"},"insert":"\n"},{"insert":"trailing"}]`,
+			want: []string{"<p>intro</p>", "<ul><li>a</li><li>b</li></ul>", "<p>trailing</p>"},
+		},
+	}
+
+	for i, tc := range cases {
+		got, err := RenderBlocks([]byte(tc.ops), nil)
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+		if len(got) != len(tc.want) {
+			t.Fatalf("(index %d) expected %d blocks but got %d: %q", i, len(tc.want), len(got), got)
+		}
+		for j := range got {
+			if got[j] != tc.want[j] {
+				t.Errorf("(index %d) expected block %d to be %q but got %q", i, j, tc.want[j], got[j])
+			}
+		}
+	}
+
+}
+
+func TestSetDefaultFormats(t *testing.T) {
+
+	ops := []byte(`[{"insert":"hi "},{"insert":{"smiley":true}},{"insert":"\n"}]`)
+
+	if _, err := Render(ops); err == nil {
+		t.Fatal("expected an error rendering an unknown embed without a default")
+	}
+
+	SetDefaultFormats(func(keyword string, o *Op) Formatter {
+		if keyword == "smiley" {
+			return new(smileyFormat)
+		}
+		return nil
+	})
+	defer SetDefaultFormats(nil)
+
+	got, err := Render(ops)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if want := `<p>hi <span class="smiley">:)</span></p>`; string(got) != want {
+		t.Errorf("expected %q but got %q", want, got)
+	}
+
+}
+
+func TestSanitizeHref(t *testing.T) {
+	cases := map[string]string{
+		"https://widerwebs.com/a?b=c": "https://widerwebs.com/a?b=c",
+		"HTTP://widerwebs.com":        "HTTP://widerwebs.com",
+		"mailto:me@example.com":       "mailto:me@example.com",
+		"#top":                        "#top",
+		"page.html#sec":               "page.html#sec",
+		"/path/page.html":             "/path/page.html",
+		"../up":                       "../up",
+		"javascript:alert(1)":         sanitizedHref,
+		" JavaScript:alert(1)":        sanitizedHref,
+		"java\tscript:alert(1)":       sanitizedHref,
+		"data:text/html,hi":           sanitizedHref,
+	}
+	for in, want := range cases {
+		if got := sanitizeHref(in); got != want {
+			t.Errorf("for %q expected %q but got %q", in, want, got)
+		}
+	}
+}
+
+func TestQuoteAttr(t *testing.T) {
+	cases := map[string]string{
+		"":                               `""`,
+		"text-align:center;":             `"text-align:center;"`,
+		`font-family:"Times New Roman";`: `"font-family:&#34;Times New Roman&#34;;"`,
+		`a'b<c>&d`:                       `"a&#39;b&lt;c&gt;&amp;d"`,
+	}
+	for in, want := range cases {
+		if got := quoteAttr(in); got != want {
+			t.Errorf("for %q expected %s but got %s", in, want, got)
+		}
+	}
+}
+
+func TestRender_quotedStyle(t *testing.T) {
+
+	custom := func(keyword string, o *Op) Formatter {
+		if keyword == "font" && o.Data == "\n" {
+			return &blockStyleFormat{"font-family", o.Attrs["font"]}
+		}
+		return nil
+	}
+
+	got, err := RenderExtended([]byte(`[{"insert":"serif"},{"attributes":{"font":"\"Times New Roman\""},"insert":"\n"}]`), custom)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if want := `<p style="font-family:&#34;Times New Roman&#34;;">serif</p>`; string(got) != want {
+		t.Errorf("expected %q but got %q", want, got)
+	}
+
+}
+
 func TestClassesList(t *testing.T) {
 	cases := []struct {
 		classes []string
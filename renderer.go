@@ -0,0 +1,59 @@
+package quill
+
+import (
+	"bytes"
+	"sync"
+)
+
+// A Renderer renders Deltas with a fixed set of Options, reusing its buffers between renders. It is safe for concurrent
+// use by multiple goroutines as long as the functions in its Options are (a FootnoteCollector is not). A Renderer must
+// not be copied after its first use.
+type Renderer struct {
+	opts Options
+	bufs sync.Pool // of *bytes.Buffer
+}
+
+// NewRenderer returns a Renderer that renders according to opts.
+func NewRenderer(opts Options) *Renderer {
+	return &Renderer{opts: opts}
+}
+
+// Render takes a Delta array of insert operations and returns the rendered HTML. If an error occurs while rendering,
+// any HTML already rendered is returned.
+func (r *Renderer) Render(ops []byte) ([]byte, error) {
+
+	buf, _ := r.bufs.Get().(*bytes.Buffer)
+	if buf == nil {
+		buf = new(bytes.Buffer)
+	}
+	buf.Reset()
+
+	err := render(buf, ops, r.opts)
+
+	html := make([]byte, buf.Len())
+	copy(html, buf.Bytes())
+	r.bufs.Put(buf)
+
+	return html, err
+
+}
+
+// RenderBatch renders many Deltas (such as a page of comments) with the optional customFormats, as RenderExtended does,
+// reusing one buffer for all of them. The HTML and the error of each Delta are at the index of the Delta; if an error
+// occurs while rendering a Delta, its HTML is what was rendered before the error.
+func RenderBatch(deltas [][]byte, customFormats func(string, *Op) Formatter) ([][]byte, []error) {
+
+	htmls := make([][]byte, len(deltas))
+	errs := make([]error, len(deltas))
+
+	var buf bytes.Buffer
+	opts := Options{CustomFormats: customFormats}
+	for i, ops := range deltas {
+		buf.Reset()
+		errs[i] = render(&buf, ops, opts)
+		htmls[i] = append([]byte(nil), buf.Bytes()...)
+	}
+
+	return htmls, errs
+
+}
@@ -0,0 +1,84 @@
+package quill
+
+import (
+	"io/ioutil"
+	"sync"
+	"testing"
+)
+
+func TestRenderer_concurrent(t *testing.T) {
+
+	r := NewRenderer(Options{ColorClasses: true})
+
+	deltas := []struct{ ops, want string }{
+		{`[{"insert":"a"},{"attributes":{"color":"red"},"insert":"b"},{"insert":"\n"}]`, `<p>a<span class="ql-color-red">b</span></p>`},
+		{`[{"insert":"item"},{"attributes":{"list":"bullet"},"insert":"\n"}]`, `<ul><li>item</li></ul>`},
+		{`[{"insert":"Title"},{"attributes":{"header":1},"insert":"\n"},{"insert":"text\n"}]`, `<h1>Title</h1><p>text</p>`},
+	}
+
+	var wg sync.WaitGroup
+	for g := 0; g < 16; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				d := deltas[(g+i)%len(deltas)]
+				got, err := r.Render([]byte(d.ops))
+				if err != nil {
+					t.Errorf("%s", err)
+					return
+				}
+				if string(got) != d.want {
+					t.Errorf("expected %q but got %q", d.want, got)
+					return
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+
+}
+
+func TestRenderBatch(t *testing.T) {
+
+	deltas := [][]byte{
+		[]byte(`[{"insert":"a"},{"attributes":{"bold":true},"insert":"b"},{"insert":"\n"}]`),
+		[]byte(`[{"insert":"ok"},{"insert":{"widget":"x"}}]`),
+		[]byte(`[{"insert":"item"},{"attributes":{"list":"bullet"},"insert":"\n"}]`),
+		[]byte(`not JSON`),
+	}
+
+	htmls, errs := RenderBatch(deltas, nil)
+	if len(htmls) != len(deltas) || len(errs) != len(deltas) {
+		t.Fatalf("got %d results and %d errors for %d deltas", len(htmls), len(errs), len(deltas))
+	}
+
+	want := []string{`<p>a<strong>b</strong></p>`, ``, `<ul><li>item</li></ul>`, ``}
+	wantErr := []bool{false, true, false, true}
+	for i := range deltas {
+		if string(htmls[i]) != want[i] {
+			t.Errorf("(delta %d) expected %q but got %q", i, want[i], htmls[i])
+		}
+		if (errs[i] != nil) != wantErr[i] {
+			t.Errorf("(delta %d) got error %v", i, errs[i])
+		}
+	}
+
+}
+
+func BenchmarkRenderBatch(b *testing.B) {
+	bts, err := ioutil.ReadFile("./testdata/ops1.json")
+	if err != nil {
+		b.Fatalf("could not read ops file: %s", err)
+	}
+	deltas := make([][]byte, 50)
+	for i := range deltas {
+		deltas[i] = bts
+	}
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		if _, errs := RenderBatch(deltas, nil); errs[0] != nil {
+			b.Errorf("error rendering: %s", errs[0])
+		}
+	}
+}
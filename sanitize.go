@@ -0,0 +1,289 @@
+package quill
+
+import (
+	"bytes"
+	"html"
+	"regexp"
+	"strings"
+)
+
+// An Allowlist maps the names of the HTML elements that are allowed in the output to the names of the attributes allowed
+// on each of them. The attributes listed for "*" are allowed on every element that is allowed, and a name that ends with
+// "*" (such as "data-*") allows every attribute whose name begins with the part before the "*".
+type Allowlist map[string][]string
+
+// DefaultAllowlist returns an Allowlist of the elements and attributes that the built-in formats write.
+func DefaultAllowlist() Allowlist {
+	return Allowlist{
+		"*":          {"class"},
+		"a":          {"href", "id", "rel", "target"},
+		"abbr":       {"title"},
+		"annotation": {"encoding"},
+		"b":          nil,
+		"blockquote": {"cite", "id"},
+		"br":         nil,
+		"code":       nil,
+		"details":    nil,
+		"em":         nil,
+		"figcaption": nil,
+		"figure":     nil,
+		"h1":         {"aria-level", "id", "role"},
+		"h2":         {"aria-level", "id", "role"},
+		"h3":         {"aria-level", "id", "role"},
+		"h4":         {"aria-level", "id", "role"},
+		"h5":         {"aria-level", "id", "role"},
+		"h6":         {"aria-level", "id", "role"},
+		"hr":         nil,
+		"i":          nil,
+		"img":        {"alt", "decoding", "height", "loading", "src", "style", "width"},
+		"input":      {"checked", "disabled", "type"},
+		"kbd":        nil,
+		"li":         {"id", "role", "value"},
+		"mark":       nil,
+		"math":       nil,
+		"mfrac":      nil,
+		"mi":         nil,
+		"mn":         nil,
+		"mo":         nil,
+		"mrow":       nil,
+		"msqrt":      nil,
+		"msub":       nil,
+		"msubsup":    nil,
+		"msup":       nil,
+		"mtext":      nil,
+		"ol":         {"data-checked", "role", "start"},
+		"p":          {"id"},
+		"pre":        nil,
+		"s":          nil,
+		"semantics":  nil,
+		"span":       {"data-*", "style"},
+		"strong":     nil,
+		"sub":        nil,
+		"summary":    nil,
+		"sup":        nil,
+		"table":      nil,
+		"td":         {"id"},
+		"tr":         nil,
+		"u":          nil,
+		"ul":         {"data-checked", "role"},
+	}
+}
+
+// rawTextTags lists the elements whose content is removed along with them when they are not allowed (rather than kept as
+// text).
+var rawTextTags = map[string]bool{
+	"iframe": true, "noembed": true, "noframes": true, "noscript": true, "script": true, "style": true, "template": true,
+	"textarea": true, "title": true, "xmp": true,
+}
+
+// urlAttrs lists the attributes that have a URL as their value.
+var urlAttrs = map[string]bool{"action": true, "cite": true, "formaction": true, "href": true, "poster": true, "src": true}
+
+// styleProps lists the CSS properties that the built-in formats write, which are the only ones kept in style attributes.
+var styleProps = map[string]bool{
+	"background-color": true, "color": true, "font-size": true, "height": true, "text-align": true, "width": true,
+}
+
+// cssValue matches the values kept in style attributes: a single keyword, number, length, or hex color, or an rgb(),
+// rgba(), hsl(), or hsla() color.
+var cssValue = regexp.MustCompile(`^(?i:[#a-z0-9.%-]+|(?:rgba?|hsla?)\([0-9.,%\s]*\))$`)
+
+// Sanitize removes from HTML the elements and attributes that al does not allow, along with comments. The content of
+// a removed element is kept (except for elements such as <script> whose content is not text), the URLs of the
+// attributes that are kept are checked just like the URLs of links, and style attributes keep only the declarations
+// of the properties in styleProps that have simple values.
+func (al Allowlist) Sanitize(b []byte) []byte {
+
+	out := make([]byte, 0, len(b))
+
+	for i := 0; i < len(b); {
+
+		if b[i] != '<' {
+			next := bytes.IndexByte(b[i:], '<')
+			if next == -1 {
+				next = len(b) - i
+			}
+			out = append(out, b[i:i+next]...)
+			i += next
+			continue
+		}
+
+		if bytes.HasPrefix(b[i:], []byte("<!--")) {
+			end := bytes.Index(b[i+4:], []byte("-->"))
+			if end == -1 {
+				break // An unterminated comment runs to the end.
+			}
+			i += 4 + end + 3
+			continue
+		}
+
+		end := tagEnd(b[i:])
+		name, closing := tagName(b[i:])
+		if end == -1 || name == "" || name[0] < 'a' || name[0] > 'z' {
+			out = append(out, "&lt;"...) // Not a tag.
+			i++
+			continue
+		}
+		tag := b[i : i+end+1]
+		i += end + 1
+
+		if _, ok := al[name]; !ok {
+			if rawTextTags[name] && !closing {
+				// Skip the content; the closing tag is dropped next.
+				if c := bytes.Index(bytes.ToLower(b[i:]), []byte("</"+name)); c != -1 {
+					i += c
+				} else {
+					i = len(b)
+				}
+			}
+			continue
+		}
+
+		if closing {
+			out = append(out, "</"+name+">"...)
+			continue
+		}
+
+		out = append(out, '<')
+		out = append(out, name...)
+		parseAttrs(tag[1+len(name):len(tag)-1], func(attr, val string, hasVal bool) {
+			if !al.allowsAttr(name, attr) {
+				return
+			}
+			if attr == "style" && hasVal {
+				if val = sanitizeStyle(val); val == "" {
+					return
+				}
+			}
+			out = append(out, ' ')
+			out = append(out, attr...)
+			if hasVal {
+				if urlAttrs[attr] && !(name == "img" && attr == "src" && isDataImage(val)) {
+					val = sanitizeHref(val)
+				}
+				out = append(out, '=')
+				out = append(out, quoteAttr(val)...)
+			}
+		})
+		out = append(out, '>')
+
+	}
+
+	return out
+
+}
+
+// sanitizeStyle gives the declarations in the style attribute value s that set a property in styleProps to a value that
+// cssValue matches, leaving out anything (such as a url() or an expression()) that could load content or run code.
+func sanitizeStyle(s string) string {
+	var out string
+	for _, decl := range strings.Split(s, ";") {
+		colon := strings.IndexByte(decl, ':')
+		if colon == -1 {
+			continue
+		}
+		prop, val := strings.ToLower(strings.TrimSpace(decl[:colon])), strings.TrimSpace(decl[colon+1:])
+		if styleProps[prop] && cssValue.MatchString(val) {
+			out += prop + ":" + val + ";"
+		}
+	}
+	return out
+}
+
+// isDataImage says if the URL is a data URL of an image (as allowed as the source of an <img> element).
+func isDataImage(u string) bool {
+	u = strings.TrimSpace(u)
+	return len(u) >= 11 && strings.EqualFold(u[:11], "data:image/")
+}
+
+// allowsAttr says if the attribute attr is allowed on the element tag.
+func (al Allowlist) allowsAttr(tag, attr string) bool {
+	for _, names := range [2][]string{al[tag], al["*"]} {
+		for _, n := range names {
+			if n == attr || (strings.HasSuffix(n, "*") && strings.HasPrefix(attr, n[:len(n)-1])) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// tagEnd gives the index of the ">" that ends the tag at the start of b (skipping quoted attribute values), or -1.
+func tagEnd(b []byte) int {
+	afterEq := false
+	for i := 1; i < len(b); i++ {
+		switch c := b[i]; {
+		case c == '>':
+			return i
+		case (c == '"' || c == '\'') && afterEq:
+			q := bytes.IndexByte(b[i+1:], c)
+			if q == -1 {
+				return -1
+			}
+			i += q + 1
+			afterEq = false
+		case c == '=':
+			afterEq = true
+		case c != ' ' && c != '\t' && c != '\n' && c != '\r' && c != '\f':
+			afterEq = false
+		}
+	}
+	return -1
+}
+
+// parseAttrs calls fn with the lowercase name and the unescaped value of each attribute in s, the part of a start tag
+// between the tag name and the closing ">".
+func parseAttrs(s []byte, fn func(name, val string, hasVal bool)) {
+
+	isSpace := func(c byte) bool { return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' }
+
+	for i := 0; i < len(s); {
+
+		if isSpace(s[i]) || s[i] == '/' {
+			i++
+			continue
+		}
+
+		start := i
+		for i < len(s) && !isSpace(s[i]) && s[i] != '=' && s[i] != '/' {
+			i++
+		}
+		if i == start {
+			i++ // A stray "=".
+			continue
+		}
+		name := strings.ToLower(string(s[start:i]))
+
+		j := i
+		for j < len(s) && isSpace(s[j]) {
+			j++
+		}
+		if j == len(s) || s[j] != '=' {
+			fn(name, "", false)
+			continue
+		}
+		j++
+		for j < len(s) && isSpace(s[j]) {
+			j++
+		}
+
+		var val []byte
+		if j < len(s) && (s[j] == '"' || s[j] == '\'') {
+			q := bytes.IndexByte(s[j+1:], s[j])
+			if q == -1 {
+				val, i = s[j+1:], len(s)
+			} else {
+				val, i = s[j+1:j+1+q], j+q+2
+			}
+		} else {
+			start = j
+			for j < len(s) && !isSpace(s[j]) {
+				j++
+			}
+			val, i = s[start:j], j
+		}
+		fn(name, html.UnescapeString(string(val)), true)
+
+	}
+
+}
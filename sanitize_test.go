@@ -0,0 +1,87 @@
+package quill
+
+import (
+	"io"
+	"testing"
+)
+
+// widgetFormat is a custom embed format that writes markup that should not be in the output.
+type widgetFormat struct{}
+
+func (*widgetFormat) Fmt() *Format { return nil }
+
+func (*widgetFormat) HasFormat(o *Op) bool { return o.Type == "widget" }
+
+func (*widgetFormat) Write(w io.Writer) {
+	io.WriteString(w, `<div onclick="steal()" class="widget">Widget<script>alert("x")</script><!-- note -->`+
+		`<a href="javascript:alert(1)" title="t">link</a></div>`)
+}
+
+func TestOptions_Sanitize(t *testing.T) {
+
+	ops := []byte(`[{"insert":"Some "},{"attributes":{"bold":true},"insert":"text"},{"insert":{"widget":"w"}},` +
+		`{"insert":"\n"}]`)
+	custom := func(keyword string, o *Op) Formatter {
+		if keyword == "widget" {
+			return new(widgetFormat)
+		}
+		return nil
+	}
+
+	got, err := RenderWithOptions(ops, Options{CustomFormats: custom, Sanitize: DefaultAllowlist()})
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	want := `<p>Some <strong>text</strong>Widget<a href="about:blank">link</a></p>`
+	if string(got) != want {
+		t.Errorf("expected %q but got %q", want, got)
+	}
+
+}
+
+func TestAllowlist_Sanitize(t *testing.T) {
+
+	cases := []struct {
+		al       Allowlist
+		in, want string
+	}{
+		{
+			al:   Allowlist{"p": nil, "*": {"class"}},
+			in:   `<P CLASS='a b' style="color: red">x</P>`,
+			want: `<p class="a b">x</p>`,
+		},
+		{
+			al:   Allowlist{"span": {"data-*"}},
+			in:   `<span data-id="1 &amp; 2" data-x=y id="z">a &lt; b</span>`,
+			want: `<span data-id="1 &amp; 2" data-x="y">a &lt; b</span>`,
+		},
+		{
+			al:   Allowlist{"img": {"alt", "src"}},
+			in:   `<img alt="a > b" src="x.png" onerror="f()"><STYLE>p{}</style>`,
+			want: `<img alt="a &gt; b" src="x.png">`,
+		},
+		{
+			al:   Allowlist{"img": {"src"}, "iframe": {"src"}},
+			in:   `<img src="data:image/png;base64,AAAA"><iframe src="data:image/svg+xml;base64,AAAA"></iframe>`,
+			want: `<img src="data:image/png;base64,AAAA"><iframe src="` + sanitizedHref + `"></iframe>`,
+		},
+		{
+			al: Allowlist{"span": {"style"}},
+			in: `<span style="color: red; background-image: url(https://x.com/a); font-size:expression(f()); COLOR:#FFF">a</span>` +
+				`<span style="position:fixed;top:0">b</span><span style="background-color:rgb(0, 0, 0);width:50%">c</span>`,
+			want: `<span style="color:red;color:#FFF;">a</span><span>b</span><span style="background-color:rgb(0, 0, 0);width:50%;">c</span>`,
+		},
+		{
+			al:   Allowlist{"input": {"checked", "type"}},
+			in:   `<input type="checkbox" checked disabled/> 1 < 2`,
+			want: `<input type="checkbox" checked> 1 &lt; 2`,
+		},
+	}
+
+	for i, tc := range cases {
+		if got := tc.al.Sanitize([]byte(tc.in)); string(got) != tc.want {
+			t.Errorf("(case %d) expected %q but got %q", i, tc.want, got)
+		}
+	}
+
+}
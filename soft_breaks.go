@@ -0,0 +1,83 @@
+package quill
+
+import "strings"
+
+// A lineFeed says what a line feed in a text op does.
+type lineFeed uint8
+
+const (
+	lineFeedBlock lineFeed = iota // end the block (the usual behavior)
+	lineFeedSoft                  // write a <br> within the paragraph (with SoftBreaks)
+	lineFeedDrop                  // nothing; the line feed separates paragraphs (with SoftBreaks)
+)
+
+// softLineFeeds gives, for each op, what each of its line feeds does when SoftBreaks is set. A line feed that ends a
+// plain paragraph line (a line without block formats) followed by another non-empty plain line is a soft break, and an
+// empty plain line that follows a non-empty plain line is dropped as it only separates paragraphs.
+func (vars *renderVars) softLineFeeds(raw []rawOp) [][]lineFeed {
+
+	type line struct {
+		op           int // the index of the op with the line feed (or -1 for trailing text not followed by a line feed)
+		plain, empty bool
+	}
+
+	var lines []line
+	empty := true
+	for i := range raw {
+		s, ok := raw[i].Insert.(string)
+		if !ok {
+			empty = false // an embed
+			continue
+		}
+		parts := strings.Split(s, "\n")
+		plain := len(parts) > 1 && vars.plainLineFeed(&raw[i])
+		for j, part := range parts {
+			if part != "" {
+				empty = false
+			}
+			if j == len(parts)-1 {
+				break
+			}
+			lines = append(lines, line{op: i, plain: plain, empty: empty})
+			empty = true
+		}
+	}
+	if !empty {
+		lines = append(lines, line{op: -1, plain: true})
+	}
+
+	feeds := make([][]lineFeed, len(raw))
+	for k, l := range lines {
+		if l.op == -1 {
+			break
+		}
+		lf := lineFeedBlock
+		switch {
+		case l.plain && !l.empty && k+1 < len(lines) && lines[k+1].plain && !lines[k+1].empty:
+			lf = lineFeedSoft
+		case l.plain && l.empty && k > 0 && lines[k-1].plain && !lines[k-1].empty:
+			lf = lineFeedDrop
+		}
+		feeds[l.op] = append(feeds[l.op], lf)
+	}
+
+	return feeds
+
+}
+
+// plainLineFeed says if the line feeds of the op end plain paragraph lines, that is, if none of its attributes gives a
+// block-level format.
+func (vars *renderVars) plainLineFeed(ro *rawOp) bool {
+	o := Op{Attrs: make(map[string]string, len(ro.Attrs))}
+	if ro.makeOp(&o) != nil {
+		return false
+	}
+	for attr := range o.Attrs {
+		if fmTer := o.getFormatter(attr, &vars.opts); fmTer != nil {
+			if fm := fmTer.Fmt(); fm != nil && fm.Block {
+				return false
+			}
+		}
+	}
+	return true
+}
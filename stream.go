@@ -0,0 +1,144 @@
+package quill
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+)
+
+// A Stream renders a Delta that arrives in parts (such as from a streaming pipeline) and writes the HTML to an io.Writer
+// as each block is completed. A Stream is not safe for concurrent use.
+//
+// The HTML of a line is held in memory until the line feed that ends it (whose attributes give the block element) is
+// reached, so the memory used grows with the length of the longest line. Unless Options.Sanitize is set, a long line
+// is written out directly from where it is rendered rather than copied first.
+type Stream struct {
+	w       io.Writer
+	buf     bytes.Buffer
+	vars    *renderVars
+	started bool // whether anything has been written out
+}
+
+// NewStream returns a Stream that writes the HTML rendered according to opts to w.
+func NewStream(w io.Writer, opts Options) *Stream {
+	s := &Stream{w: w}
+	s.vars = newRenderVars(&s.buf, opts)
+	s.vars.out = s.write
+	return s
+}
+
+// RenderTo renders a Delta array of insert operations according to opts and writes the HTML to w.
+func RenderTo(w io.Writer, ops []byte, opts Options) error {
+	s := NewStream(w, opts)
+	if err := s.Render(ops); err != nil {
+		return err
+	}
+	return s.Close()
+}
+
+// RenderedSize gives the length in bytes of the HTML that RenderExtended renders from a Delta array of insert operations
+// with the optional customFormats, without keeping the HTML (for checking quotas).
+func RenderedSize(ops []byte, customFormats func(string, *Op) Formatter) (int, error) {
+	var cw countWriter
+	err := RenderTo(&cw, ops, Options{CustomFormats: customFormats})
+	return cw.n, err
+}
+
+// A countWriter is an io.Writer that counts the bytes written to it and drops them.
+type countWriter struct {
+	n int
+}
+
+func (cw *countWriter) Write(p []byte) (int, error) {
+	cw.n += len(p)
+	return len(p), nil
+}
+
+// RenderHTTP renders a Delta array of insert operations (with the optional customFormats, as for RenderExtended) as an
+// HTML response. The Content-Type header is set to HTML, and if w is an http.Flusher, the response is flushed after each
+// top-level block so that the client can display the document progressively.
+func RenderHTTP(w http.ResponseWriter, ops []byte, customFormats func(string, *Op) Formatter) error {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	flusher, _ := w.(http.Flusher)
+	var s *Stream
+	opts := Options{
+		CustomFormats: customFormats,
+		blockEnd: func() {
+			if s.buf.Len() == 0 {
+				return
+			}
+			// An error writing is reported when the Stream writes out the rest.
+			if s.writeOut() == nil && flusher != nil {
+				flusher.Flush()
+			}
+		},
+	}
+	s = NewStream(w, opts)
+	if err := s.Render(ops); err != nil {
+		return err
+	}
+	if err := s.Close(); err != nil {
+		return err
+	}
+	if flusher != nil {
+		flusher.Flush()
+	}
+	return nil
+}
+
+// Render renders the next part of the Delta, given as a JSON array of insert operations. The HTML of the blocks that are
+// completed is written out; inline content that is not yet followed by a line feed is held until a later part ends its
+// line or until Flush or Close is called.
+func (s *Stream) Render(ops []byte) error {
+	raw, err := parseDelta(ops)
+	if err != nil {
+		return err
+	}
+	err = s.vars.writeOps(raw)
+	s.vars.sanitize(0)
+	if wErr := s.writeOut(); err == nil {
+		err = wErr
+	}
+	return err
+}
+
+// Flush closes all open inline and block formats and writes out everything rendered so far, so the output written is
+// well-formed HTML. Inline content not yet followed by a line feed is written as a block of its own, and a block-level
+// FormatWrapper (such as a list) that continues in a later part of the Delta is opened again.
+func (s *Stream) Flush() error {
+	s.vars.closeAll()
+	s.vars.sanitize(0)
+	return s.writeOut()
+}
+
+// Close flushes the Stream and writes what comes after the content of the document (such as footnotes). It does not
+// close the underlying io.Writer.
+func (s *Stream) Close() error {
+	s.vars.closeAll()
+	s.vars.sanitize(0)
+	s.vars.endDocument()
+	return s.writeOut()
+}
+
+// writeOut writes the rendered HTML held in the buffer to the io.Writer.
+func (s *Stream) writeOut() error {
+	if s.vars.outErr != nil {
+		return s.vars.outErr
+	}
+	return s.write(&s.buf)
+}
+
+// write writes out and empties b, after the start of the document the first time.
+func (s *Stream) write(b *bytes.Buffer) error {
+	if !s.started {
+		// The start is not in the buffer so that it is not sanitized.
+		s.started = true
+		var start bytes.Buffer
+		s.vars.startDocument(&start)
+		if _, err := start.WriteTo(s.w); err != nil {
+			return err
+		}
+	}
+	_, err := b.WriteTo(s.w)
+	return err
+}
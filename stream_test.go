@@ -0,0 +1,196 @@
+package quill
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestRenderTo(t *testing.T) {
+
+	var buf bytes.Buffer
+	if err := RenderTo(&buf, []byte(`[{"insert":"a"},{"attributes":{"bold":true},"insert":"b"},{"insert":"\n"}]`), Options{}); err != nil {
+		t.Fatalf("%s", err)
+	}
+	if want := "<p>a<strong>b</strong></p>"; buf.String() != want {
+		t.Errorf("expected %q but got %q", want, buf.String())
+	}
+
+}
+
+func TestStream_Flush(t *testing.T) {
+
+	var buf bytes.Buffer
+	s := NewStream(&buf, Options{})
+
+	if err := s.Render([]byte(`[{"insert":"one"},{"attributes":{"list":"bullet"},"insert":"\n"},{"insert":"half "},{"attributes":{"bold":true},"insert":"bold"}]`)); err != nil {
+		t.Fatalf("%s", err)
+	}
+	if want := "<ul><li>one</li>"; buf.String() != want {
+		t.Errorf("before flushing, expected %q but got %q", want, buf.String())
+	}
+
+	if err := s.Flush(); err != nil {
+		t.Fatalf("%s", err)
+	}
+	if want := "<ul><li>one</li></ul><p>half <strong>bold</strong></p>"; buf.String() != want {
+		t.Errorf("after flushing, expected %q but got %q", want, buf.String())
+	}
+
+	buf.Reset()
+	if err := s.Render([]byte(`[{"insert":"two"},{"attributes":{"list":"bullet"},"insert":"\n"}]`)); err != nil {
+		t.Fatalf("%s", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("%s", err)
+	}
+	if want := "<ul><li>two</li></ul>"; buf.String() != want {
+		t.Errorf("after closing, expected %q but got %q", want, buf.String())
+	}
+
+}
+
+// flushRecorder records the body of a response as it is at each flush.
+type flushRecorder struct {
+	*httptest.ResponseRecorder
+	flushed []string
+}
+
+func (fr *flushRecorder) Flush() {
+	fr.flushed = append(fr.flushed, fr.Body.String())
+	fr.ResponseRecorder.Flush()
+}
+
+func TestRenderHTTP(t *testing.T) {
+
+	rec := &flushRecorder{ResponseRecorder: httptest.NewRecorder()}
+	ops := []byte(`[{"insert":"Title"},{"attributes":{"header":1},"insert":"\n"},{"insert":"one"},{"attributes":{"list":"bullet"},"insert":"\n"},` +
+		`{"insert":"two"},{"attributes":{"list":"bullet"},"insert":"\n"},{"insert":"end\n"}]`)
+	if err := RenderHTTP(rec, ops, nil); err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	if ct := rec.Header().Get("Content-Type"); ct != "text/html; charset=utf-8" {
+		t.Errorf("got Content-Type %q", ct)
+	}
+	if want := "<h1>Title</h1><ul><li>one</li><li>two</li></ul><p>end</p>"; rec.Body.String() != want {
+		t.Errorf("expected %q but got %q", want, rec.Body.String())
+	}
+
+	// The response is flushed after each top-level block.
+	want := []string{"<h1>Title</h1>", "<h1>Title</h1><ul><li>one</li><li>two</li></ul>", "<h1>Title</h1><ul><li>one</li><li>two</li></ul><p>end</p>"}
+	if len(rec.flushed) != len(want) {
+		t.Fatalf("expected %d flushes but got %q", len(want), rec.flushed)
+	}
+	for i := range want {
+		if rec.flushed[i] != want[i] {
+			t.Errorf("(flush %d) expected %q but got %q", i, want[i], rec.flushed[i])
+		}
+	}
+
+}
+
+// failWriter is an io.Writer that fails after n bytes are written.
+type failWriter struct {
+	n int
+}
+
+func (fw *failWriter) Write(p []byte) (int, error) {
+	if len(p) > fw.n {
+		return 0, errors.New("write failed")
+	}
+	fw.n -= len(p)
+	return len(p), nil
+}
+
+func TestRenderTo_longLine(t *testing.T) {
+
+	text := strings.Repeat("a<b & c ", 1<<17) // 1 MiB
+	for _, ops := range []string{
+		`[{"insert":"before\n` + text + `"}]`,
+		`[{"insert":"` + text + `"},{"attributes":{"header":2},"insert":"\n"},{"insert":"after\n"}]`,
+		`[{"insert":"` + text + `"},{"attributes":{"code-block":true},"insert":"\n"}]`,
+	} {
+		want, err := Render([]byte(ops))
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+		var buf bytes.Buffer
+		if err = RenderTo(&buf, []byte(ops), Options{}); err != nil {
+			t.Fatalf("%s", err)
+		}
+		if !bytes.Equal(buf.Bytes(), want) {
+			t.Errorf("the streamed output (%d bytes) differs from the rendered output (%d bytes)", buf.Len(), len(want))
+		}
+	}
+
+	// A long line is not copied to be written out: rendering it allocates at most a few times its length.
+	long := []byte(`[{"insert":"` + strings.Repeat("a<b & c ", 1<<19) + `"}]`) // 4 MiB of text on one line
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	if err := RenderTo(ioutil.Discard, long, Options{}); err != nil {
+		t.Fatalf("%s", err)
+	}
+	runtime.ReadMemStats(&after)
+	if alloc := after.TotalAlloc - before.TotalAlloc; alloc > 6*uint64(len(long)) {
+		t.Errorf("rendering a line of %d bytes allocated %d bytes", len(long), alloc)
+	}
+
+	// An error writing out a long line is returned.
+	ops := []byte(`[{"insert":"` + text + `\n"}]`)
+	if err := RenderTo(&failWriter{n: 100}, ops, Options{}); err == nil {
+		t.Errorf("no error for a failed write")
+	}
+
+}
+
+func BenchmarkRenderTo_longLine(b *testing.B) {
+	ops := []byte(`[{"insert":"` + strings.Repeat("a<b & c ", 1<<19) + `"}]`) // 4 MiB of text on one line
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		if err := RenderTo(ioutil.Discard, ops, Options{}); err != nil {
+			b.Fatalf("%s", err)
+		}
+	}
+}
+
+func TestRenderedSize(t *testing.T) {
+
+	deltas := []string{
+		`[{"insert":"a < b"},{"attributes":{"bold":true},"insert":"c"},{"insert":"\nitem"},{"attributes":{"list":"bullet"},"insert":"\n"}]`,
+		`[{"insert":"` + strings.Repeat("x & y ", 20000) + `\n"}]`,
+		`[]`,
+	}
+	for _, f := range []string{"./testdata/ops1.json", "./testdata/list4.json", "./testdata/nested.json"} {
+		bts, err := ioutil.ReadFile(f)
+		if err != nil {
+			t.Fatalf("could not read ops file: %s", err)
+		}
+		deltas = append(deltas, string(bts))
+	}
+
+	for i, ops := range deltas {
+		html, err := Render([]byte(ops))
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+		n, err := RenderedSize([]byte(ops), nil)
+		if err != nil {
+			t.Fatalf("(delta %d) %s", i, err)
+		}
+		if n != len(html) {
+			t.Errorf("(delta %d) expected a size of %d but got %d", i, len(html), n)
+		}
+	}
+
+	if _, err := RenderedSize([]byte(`not JSON`), nil); err == nil {
+		t.Errorf("no error for invalid JSON")
+	}
+
+}
@@ -0,0 +1,53 @@
+package quill
+
+import (
+	"bytes"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// styleClassPrefix begins the names of the classes generated for styles when Options.StyleNonce is set.
+const styleClassPrefix = "ql-s-"
+
+// styleClass returns the name of the class generated for the style declarations decl and records the rule for the class.
+// The name is made from a hash of decl; if another decl has the same hash, a number is added to the name. If decl could
+// break out of a style sheet rule, false is returned.
+func (vars *renderVars) styleClass(decl string) (string, bool) {
+	if strings.ContainsAny(decl, "<>{}\\") {
+		return "", false
+	}
+	h := fnv.New32a()
+	h.Write([]byte(decl))
+	base := styleClassPrefix + strconv.FormatUint(uint64(h.Sum32()), 36)
+	if vars.styleRules == nil {
+		vars.styleRules = make(map[string]string)
+	}
+	class := base
+	for n := 2; ; n++ {
+		if d, ok := vars.styleRules[class]; !ok || d == decl {
+			break
+		}
+		class = base + "-" + strconv.Itoa(n)
+	}
+	vars.styleRules[class] = decl
+	return class, true
+}
+
+// writeStyleSheet writes a <style> element with the rules of the classes generated for styles, if there are any.
+func (vars *renderVars) writeStyleSheet(buf *bytes.Buffer) {
+	if len(vars.styleRules) == 0 {
+		return
+	}
+	classes := make([]string, 0, len(vars.styleRules))
+	for c := range vars.styleRules {
+		classes = append(classes, c)
+	}
+	sort.Strings(classes)
+	buf.WriteString("<style nonce=" + quoteAttr(vars.opts.StyleNonce) + ">")
+	for _, c := range classes {
+		buf.WriteString("." + c + "{" + vars.styleRules[c] + "}")
+	}
+	buf.WriteString("</style>")
+}
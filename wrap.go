@@ -0,0 +1,141 @@
+package quill
+
+import (
+	"bytes"
+	"io"
+	"strings"
+)
+
+// Wrap returns a Formatter that works like base but with its Format changed by modify, so that a format (such as one given
+// by BuiltinFormatter) can be extended without writing a whole Formatter. The returned Formatter implements FormatWrapper
+// or FormatWriter if base does. A FormatWrapper writes what its Wrap method gives rather than its Format, so for a
+// FormatWrapper only the Attrs set by modify are used: they are added to the first tag of the opening wrap (and not to the
+// element of each line, such as the <li> of a list item).
+func Wrap(base Formatter, modify func(*Format)) Formatter {
+	w := wrappedFormat{base, modify}
+	switch base.(type) {
+	case FormatWrapper:
+		return &wrappedWrapper{w}
+	case FormatWriter:
+		return &wrappedWriter{w}
+	}
+	return &w
+}
+
+// A wrappedFormat is a Formatter given by Wrap.
+type wrappedFormat struct {
+	base   Formatter
+	modify func(*Format)
+}
+
+func (wf *wrappedFormat) Fmt() *Format {
+	fm := wf.base.Fmt()
+	if fm != nil && wf.modify != nil {
+		wf.modify(fm)
+	}
+	return fm
+}
+
+func (wf *wrappedFormat) HasFormat(o *Op) bool {
+	return wf.base.HasFormat(o)
+}
+
+// wrappedFormat implements the blockContentFormatter interface.
+func (wf *wrappedFormat) blockContent(o *Op) (string, string) {
+	if bc, ok := wf.base.(blockContentFormatter); ok {
+		return bc.blockContent(o)
+	}
+	return "", ""
+}
+
+// wrappedFormat implements the blockAttrsFormatter interface.
+func (wf *wrappedFormat) blockAttrs(open []*Format, o *Op) map[string]string {
+	if ba, ok := wf.base.(blockAttrsFormatter); ok {
+		return ba.blockAttrs(unwrapFormats(open), o)
+	}
+	return nil
+}
+
+func (wf *wrappedFormat) unwrap() Formatter {
+	return wf.base
+}
+
+// A wrappedWrapper is a FormatWrapper given by Wrap.
+type wrappedWrapper struct {
+	wrappedFormat
+}
+
+// Fmt gives the Format of base unchanged because modify changes only the opening wrap.
+func (ww *wrappedWrapper) Fmt() *Format {
+	return ww.base.Fmt()
+}
+
+func (ww *wrappedWrapper) Wrap() (string, string) {
+	pre, post := ww.base.(FormatWrapper).Wrap()
+	fm := ww.wrappedFormat.Fmt()
+	if fm == nil || len(fm.Attrs) == 0 {
+		return pre, post
+	}
+	end := strings.IndexByte(pre, '>')
+	if end == -1 {
+		return pre, post
+	}
+	if end > 0 && pre[end-1] == '/' {
+		end--
+	}
+	var buf bytes.Buffer
+	buf.WriteString(pre[:end])
+	writeAttrs(&buf, fm.Attrs)
+	buf.WriteString(pre[end:])
+	return buf.String(), post
+}
+
+func (ww *wrappedWrapper) Open(open []*Format, o *Op) bool {
+	return ww.base.(FormatWrapper).Open(unwrapFormats(open), o)
+}
+
+func (ww *wrappedWrapper) Close(open []*Format, o *Op, doingBlock bool) bool {
+	return ww.base.(FormatWrapper).Close(unwrapFormats(open), o, doingBlock)
+}
+
+// A wrappedWriter is a FormatWriter given by Wrap.
+type wrappedWriter struct {
+	wrappedFormat
+}
+
+func (ww *wrappedWriter) Write(w io.Writer) {
+	ww.base.(FormatWriter).Write(w)
+}
+
+// baseFormatter gives the Formatter that fmTer wraps if it was given by Wrap, and fmTer otherwise.
+func baseFormatter(fmTer Formatter) Formatter {
+	for {
+		w, ok := fmTer.(interface{ unwrap() Formatter })
+		if !ok {
+			return fmTer
+		}
+		fmTer = w.unwrap()
+	}
+}
+
+// unwrapFormats returns the open formats with the Formatters given by Wrap replaced with the Formatters they wrap, so that
+// a Formatter can find the open formats of its own kind.
+func unwrapFormats(open []*Format) []*Format {
+	var unwrapped []*Format
+	for i, f := range open {
+		if _, ok := f.fm.(interface{ unwrap() Formatter }); !ok {
+			continue
+		}
+		if unwrapped == nil {
+			unwrapped = make([]*Format, len(open))
+			copy(unwrapped, open)
+		}
+		c := *f
+		c.fm = baseFormatter(f.fm)
+		unwrapped[i] = &c
+	}
+	if unwrapped == nil {
+		return open
+	}
+	return unwrapped
+}
@@ -0,0 +1,30 @@
+package quill
+
+import "testing"
+
+func TestWrap(t *testing.T) {
+
+	formats := map[string]func(*Op) Formatter{
+		"link": func(o *Op) Formatter {
+			return Wrap(BuiltinFormatter("link", o), func(fm *Format) {
+				fm.Attrs = map[string]string{"class": "tracked"}
+			})
+		},
+		"bold": func(o *Op) Formatter {
+			return Wrap(BuiltinFormatter("bold", o), func(fm *Format) {
+				fm.Val = "b"
+			})
+		},
+	}
+
+	ops := []byte(`[{"attributes":{"link":"/a"},"insert":"one "},{"attributes":{"link":"/a","bold":true},"insert":"two"},{"insert":"\n"}]`)
+
+	got, err := RenderWithFormatMap(ops, formats)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if want := `<p><a href="/a" target="_blank" class="tracked">one <b>two</b></a></p>`; string(got) != want {
+		t.Errorf("expected %q but got %q", want, got)
+	}
+
+}